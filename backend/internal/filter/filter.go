@@ -0,0 +1,243 @@
+// Package filter implements the expression language used to filter gadget
+// events, e.g.
+//
+//	dst.port == 5432 && error != 0
+//	k8s.namespace in ["payments", "orders"]
+//	!(comm ^= "kube") || exists(args)
+//
+// Fields are dotted paths into the event data. Comparisons are ==, !=, <,
+// <=, >, >=, ^= (string prefix) and in [...]; exists(field) tests presence.
+// Terms combine with &&, || and !, grouped with parentheses. Values are
+// numbers, double-quoted strings, true, false and null.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled filter expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// Parse compiles a filter expression
+func Parse(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+// Match reports whether event data satisfies the expression
+func (e *Expr) Match(data map[string]interface{}) bool {
+	return e.root.match(data)
+}
+
+// String returns the expression's source
+func (e *Expr) String() string {
+	return e.source
+}
+
+// node is a term of a parsed expression
+type node interface {
+	match(data map[string]interface{}) bool
+}
+
+type andNode struct{ left, right node }
+
+type orNode struct{ left, right node }
+
+type notNode struct{ operand node }
+
+// compareNode compares a field with a literal
+type compareNode struct {
+	field string
+	op    string
+	value interface{} // float64, string, bool or nil
+}
+
+// inNode tests a field against a list of literals
+type inNode struct {
+	field  string
+	values []interface{}
+}
+
+// existsNode tests whether a field is present
+type existsNode struct {
+	field string
+}
+
+func (n *andNode) match(data map[string]interface{}) bool {
+	return n.left.match(data) && n.right.match(data)
+}
+
+func (n *orNode) match(data map[string]interface{}) bool {
+	return n.left.match(data) || n.right.match(data)
+}
+
+func (n *notNode) match(data map[string]interface{}) bool {
+	return !n.operand.match(data)
+}
+
+func (n *compareNode) match(data map[string]interface{}) bool {
+	actual, ok := Lookup(data, n.field)
+
+	switch n.op {
+	case "==":
+		return ok && equal(actual, n.value)
+	case "!=":
+		return !ok || !equal(actual, n.value)
+	case "^=":
+		s, isString := actual.(string)
+		prefix, _ := n.value.(string)
+		return ok && isString && strings.HasPrefix(s, prefix)
+	}
+
+	if !ok {
+		return false
+	}
+	cmp, comparable := compare(actual, n.value)
+	if !comparable {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func (n *inNode) match(data map[string]interface{}) bool {
+	actual, ok := Lookup(data, n.field)
+	if !ok {
+		return false
+	}
+	for _, value := range n.values {
+		if equal(actual, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *existsNode) match(data map[string]interface{}) bool {
+	_, ok := Lookup(data, n.field)
+	return ok
+}
+
+// Lookup resolves a dotted field path in event data. Gadgets nest some
+// fields ({"k8s": {"namespace": ...}}) and flatten others
+// ({"k8s.namespace": ...}), so both layouts are tried at every level.
+func Lookup(data map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := data[path]; ok {
+		return value, true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := data[path[:i]].(map[string]interface{}); ok {
+			if value, ok := Lookup(nested, path[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// equal compares an event value with a literal. Numeric strings compare
+// equal to numbers, since gadgets are not consistent about port types.
+func equal(actual, literal interface{}) bool {
+	if cmp, ok := compare(actual, literal); ok {
+		return cmp == 0
+	}
+	switch l := literal.(type) {
+	case bool:
+		b, ok := actual.(bool)
+		return ok && b == l
+	case nil:
+		return actual == nil
+	}
+	return false
+}
+
+// compare orders an event value against a number or string literal
+func compare(actual, literal interface{}) (int, bool) {
+	switch l := literal.(type) {
+	case float64:
+		a, ok := number(actual)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < l:
+			return -1, true
+		case a > l:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, l), true
+	}
+	return 0, false
+}
+
+// number converts an event value to float64. Events decoded from JSON hold
+// float64, the gRPC runner decodes integer fields to int64 and uint64, and
+// numeric strings are accepted as in equal.
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		return parsed, err == nil
+	}
+	return 0, false
+}
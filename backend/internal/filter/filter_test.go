@@ -0,0 +1,292 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// decode parses an event as the CLI runner does, with numbers as float64
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &data); err != nil {
+		t.Fatalf("invalid event: %v", err)
+	}
+	return data
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{``, `expected a field, got end of expression at position 0`},
+		{`comm == "curl`, `unterminated string at position 8`},
+		{`comm == "\q"`, `invalid string at position 8`},
+		{`port == 1.2.3`, `invalid number "1.2.3" at position 8`},
+		{`comm ~ "curl"`, `unexpected character '~' at position 5`},
+		{`comm == 'curl'`, `unexpected character '\'' at position 8`},
+		{`error == 0 &&`, `expected a field, got end of expression at position 13`},
+		{`(error == 0`, `expected ")", got end of expression at position 11`},
+		{`error == 0)`, `unexpected ")" at position 10`},
+		{`error 0`, `expected a comparison after "error", got "0" at position 6`},
+		{`error == port`, `expected a value, got "port" at position 9`},
+		{`error < true`, `< needs a number or string at position 6`},
+		{`latency >= null`, `>= needs a number or string at position 8`},
+		{`comm ^= 1`, `^= needs a string at position 5`},
+		{`comm in "curl"`, `expected "[", got "\"curl\"" at position 8`},
+		{`comm in ["curl" "wget"]`, `expected ",", got "\"wget\"" at position 16`},
+		{`comm in ["curl",]`, `expected a value, got "]" at position 16`},
+		{`exists(1)`, `expected a field, got "1" at position 7`},
+		{`exists(args`, `expected ")", got end of expression at position 11`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded", tt.expr)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("Parse(%q)\n got: %s\nwant: %s", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	data := decode(t, `{
+		"comm": "kubelet",
+		"error": 0,
+		"port": "5432",
+		"latency": 12.5,
+		"ok": true,
+		"parent": null
+	}`)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Comparisons
+		{`error == 0`, true},
+		{`error == -1`, false},
+		{`port == 5432`, true},
+		{`port > 1024`, true},
+		{`latency >= 12.5`, true},
+		{`latency < 12.5`, false},
+		{`latency <= 1.25e1`, true},
+		{`comm == "kubelet"`, true},
+		{`comm > "kube"`, true},
+		{`comm < 1`, false},
+		{`ok == true`, true},
+		{`ok == false`, false},
+		{`parent == null`, true},
+		{`error == null`, false},
+		{`comm == 1`, false},
+
+		// Missing fields only satisfy !=
+		{`missing == 0`, false},
+		{`missing != 0`, true},
+		{`missing != null`, true},
+		{`missing < 1`, false},
+		{`missing ^= ""`, false},
+		{`missing in [0, null]`, false},
+
+		// Prefix, membership and presence
+		{`comm ^= "kube"`, true},
+		{`comm ^= "Kube"`, false},
+		{`error ^= "0"`, false},
+		{`comm in ["containerd", "kubelet"]`, true},
+		{`comm in []`, false},
+		{`error in [1, 0]`, true},
+		{`port in [80, 5432]`, true},
+		{`exists(parent)`, true},
+		{`exists(missing)`, false},
+		{`!exists(missing)`, true},
+
+		// && binds tighter than ||, ! tighter than both
+		{`error == 1 && comm == "kubelet" || ok == true`, true},
+		{`error == 1 && (comm == "kubelet" || ok == true)`, false},
+		{`ok == true || error == 1 && comm == "sshd"`, true},
+		{`(ok == true || error == 1) && comm == "sshd"`, false},
+		{`!ok == true || error == 0`, true},
+		{`!(ok == true || error == 0)`, false},
+		{`!!(comm ^= "kube")`, true},
+		{`((error == 0))`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := expr.Match(data); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchIntegers(t *testing.T) {
+	// The gRPC runner decodes integer fields to int64 and uint64
+	data := map[string]interface{}{
+		"error":   int64(-111),
+		"fd":      int32(3),
+		"mntns":   uint64(4026531840),
+		"latency": float32(0.5),
+		"dst":     map[string]interface{}{"port": uint64(5432)},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`error == -111`, true},
+		{`error != 0`, true},
+		{`error < 0`, true},
+		{`fd in [3, 4]`, true},
+		{`mntns == 4026531840`, true},
+		{`mntns > 4026531839`, true},
+		{`latency == 0.5`, true},
+		{`dst.port == 5432`, true},
+		{`dst.port in [80, 443]`, false},
+		{`dst.port >= 1024 && error != 0`, true},
+		{`dst.port == "5432"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := expr.Match(data); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	data := decode(t, `{
+		"k8s": {"namespace": "demo", "owner": {"kind": "Deployment"}},
+		"k8s.node": "node-1",
+		"src": {"k8s.kind": "pod"},
+		"dst.k8s": {"name": "db"},
+		"a.b": 1,
+		"a": {"b": 2}
+	}`)
+
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOK bool
+	}{
+		{"k8s.namespace", "demo", true},
+		{"k8s.owner.kind", "Deployment", true},
+		{"k8s.node", "node-1", true},
+		{"src.k8s.kind", "pod", true},
+		{"dst.k8s.name", "db", true},
+		{"a.b", 1.0, true}, // The flattened key wins
+		{"k8s.name", nil, false},
+		{"k8s.namespace.x", nil, false},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := Lookup(data, tt.path)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Lookup(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMatchEvents(t *testing.T) {
+	connect := decode(t, `{
+		"type": "connect",
+		"fd": 3,
+		"error": 0,
+		"src": {"addr": "10.42.0.15", "port": 45678, "k8s": {"kind": "pod", "namespace": "demo"}},
+		"dst": {"addr": "10.43.0.100", "port": 5432, "k8s": {"kind": "svc", "name": "postgres", "namespace": "payments"}},
+		"k8s": {"node": "k3s-node-1", "namespace": "demo", "podName": "apples-7d9f8b-xyz"},
+		"proc": {"comm": "python3", "pid": 12345}
+	}`)
+	refused := decode(t, `{
+		"type": "connect",
+		"error": 111,
+		"src": {"addr": "10.42.0.16", "port": 45700},
+		"dst": {"addr": "10.43.0.100", "port": 5432},
+		"k8s.namespace": "orders",
+		"proc.comm": "psql"
+	}`)
+	query := decode(t, `{
+		"k8s": {"node": "k3s-node-1", "namespace": "demo", "podName": "apples-7d9f8b-xyz"},
+		"proc": {"comm": "curl", "pid": 4242},
+		"id": "a1b2",
+		"qr": "Q",
+		"qtype": "AAAA",
+		"name": "oranges-service.demo.svc.cluster.local."
+	}`)
+	response := decode(t, `{
+		"k8s": {"node": "k3s-node-1", "namespace": "demo", "podName": "apples-7d9f8b-xyz"},
+		"proc": {"comm": "curl", "pid": 4242},
+		"id": "a1b2",
+		"qr": "R",
+		"qtype": "A",
+		"name": "oranges-service.demo.svc.cluster.local.",
+		"rcode": "Success",
+		"latency_ns": 120000,
+		"addresses": ["10.43.0.101"]
+	}`)
+
+	events := map[string]map[string]interface{}{
+		"connect":  connect,
+		"refused":  refused,
+		"query":    query,
+		"response": response,
+	}
+
+	tests := []struct {
+		expr string
+		want []string // Events that match, in the order above
+	}{
+		{`dst.port == 5432 && error != 0`, []string{"refused"}},
+		{`dst.port == 5432`, []string{"connect", "refused"}},
+		{`k8s.namespace in ["payments", "orders"]`, []string{"refused"}},
+		{`dst.k8s.namespace == "payments"`, []string{"connect"}},
+		{`proc.comm ^= "p"`, []string{"connect", "refused"}},
+		{`type == "connect" && !(src.k8s.kind == "pod")`, []string{"refused"}},
+		{`qr == "R" && rcode != "Success"`, nil},
+		{`qtype in ["A", "AAAA"] && name ^= "oranges-service."`, []string{"query", "response"}},
+		{`exists(addresses) || latency_ns > 100000`, []string{"response"}},
+		{`k8s.namespace == "demo" && proc.comm != "curl"`, []string{"connect"}},
+		{`error != 0`, []string{"refused", "query", "response"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			var got []string
+			for _, name := range []string{"connect", "refused", "query", "response"} {
+				if expr.Match(events[name]) {
+					got = append(got, name)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("%q matched %v, want %v", tt.expr, got, tt.want)
+				}
+			}
+		})
+	}
+}
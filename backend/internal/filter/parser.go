@@ -0,0 +1,280 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp // operators and punctuation
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{} // Parsed value of string and number tokens
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators lists the operator tokens, longest first
+var operators = []string{"==", "!=", "<=", ">=", "^=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// tokenize splits an expression into tokens
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"':
+			// Find the closing quote, skipping escaped characters
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			text := string(runes[i : end+1])
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, value: value, pos: i})
+			i = end + 1
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' || runes[end] == 'e' || runes[end] == 'E') {
+				end++
+			}
+			text := string(runes[i:end])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, i)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value, pos: i})
+			i = end
+
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i:end]), pos: i})
+			i = end
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if i+len(op) <= len(runes) && string(runes[i:i+len(op)]) == op {
+					tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+// parser is a recursive descent parser over the token list
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given operator
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokenOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q, got %s at position %d", op, tok, tok.pos)
+	}
+	return nil
+}
+
+// parseOr parses: and ('||' and)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: unary ('&&' unary)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses: '!' unary | '(' or ')' | exists(field) | comparison
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return nil, fmt.Errorf("expected a field, got %s at position %d", tok, tok.pos)
+	}
+
+	if tok.text == "exists" && p.accept("(") {
+		field := p.next()
+		if field.kind != tokenIdent {
+			return nil, fmt.Errorf("expected a field, got %s at position %d", field, field.pos)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &existsNode{field: field.text}, nil
+	}
+
+	return p.parseComparison(tok.text)
+}
+
+// parseComparison parses the operator and value following a field
+func (p *parser) parseComparison(field string) (node, error) {
+	op := p.next()
+
+	if op.kind == tokenIdent && op.text == "in" {
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		var values []interface{}
+		for !p.accept("]") {
+			if len(values) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return &inNode{field: field, values: values}, nil
+	}
+
+	switch op.text {
+	case "==", "!=", "<", "<=", ">", ">=", "^=":
+		if op.kind != tokenOp {
+			break
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		switch op.text {
+		case "<", "<=", ">", ">=":
+			if _, ok := value.(bool); ok || value == nil {
+				return nil, fmt.Errorf("%s needs a number or string at position %d", op.text, op.pos)
+			}
+		case "^=":
+			if _, ok := value.(string); !ok {
+				return nil, fmt.Errorf("^= needs a string at position %d", op.pos)
+			}
+		}
+		return &compareNode{field: field, op: op.text, value: value}, nil
+	}
+
+	return nil, fmt.Errorf("expected a comparison after %q, got %s at position %d", field, op, op.pos)
+}
+
+// parseValue parses a literal
+func (p *parser) parseValue() (interface{}, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return tok.value, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value, got %s at position %d", tok, tok.pos)
+}
@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SQL compiles the expression into a parameterized SQL condition over a
+// JSONB column. Placeholders are numbered after the arguments already in
+// args, and the values they refer to are appended to it.
+//
+// Equality and in use JSONB containment so the column's GIN index can be
+// used; unlike live matching they compare JSON values exactly, so a numeric
+// string does not equal a number.
+func (e *Expr) SQL(column string, args []interface{}) (string, []interface{}) {
+	c := &sqlCompiler{column: column, args: args}
+	return c.compile(e.root), c.args
+}
+
+type sqlCompiler struct {
+	column string
+	args   []interface{}
+}
+
+// arg adds a query argument and returns its placeholder
+func (c *sqlCompiler) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+// compile returns a condition that is never NULL, so negation is safe
+func (c *sqlCompiler) compile(n node) string {
+	switch n := n.(type) {
+	case *andNode:
+		return fmt.Sprintf("(%s AND %s)", c.compile(n.left), c.compile(n.right))
+	case *orNode:
+		return fmt.Sprintf("(%s OR %s)", c.compile(n.left), c.compile(n.right))
+	case *notNode:
+		return fmt.Sprintf("(NOT %s)", c.compile(n.operand))
+	case *existsNode:
+		return fmt.Sprintf("(%s IS NOT NULL)", c.field(n.field))
+	case *inNode:
+		if len(n.values) == 0 {
+			return "FALSE"
+		}
+		terms := make([]string, 0, len(n.values))
+		for _, value := range n.values {
+			terms = append(terms, c.equal(n.field, value))
+		}
+		return "(" + strings.Join(terms, " OR ") + ")"
+	case *compareNode:
+		return c.comparison(n)
+	}
+	return "FALSE"
+}
+
+// field returns the JSONB value of a dotted field path, which may be
+// stored nested or flattened
+func (c *sqlCompiler) field(path string) string {
+	return fmt.Sprintf("COALESCE(%s #> %s::text[], %s -> %s::text)",
+		c.column, c.arg(strings.Split(path, ".")), c.column, c.arg(path))
+}
+
+// equal tests a field for a literal value by containment
+func (c *sqlCompiler) equal(path string, value interface{}) string {
+	if value == nil {
+		return fmt.Sprintf("COALESCE(jsonb_typeof(%s) = 'null', FALSE)", c.field(path))
+	}
+
+	// Build {"a": {"b": value}} for the nested layout and {"a.b": value}
+	// for the flattened one
+	nested := value
+	segments := strings.Split(path, ".")
+	for i := len(segments) - 1; i >= 0; i-- {
+		nested = map[string]interface{}{segments[i]: nested}
+	}
+	nestedJSON, _ := json.Marshal(nested)
+	if len(segments) == 1 {
+		return fmt.Sprintf("%s @> %s::jsonb", c.column, c.arg(string(nestedJSON)))
+	}
+	flatJSON, _ := json.Marshal(map[string]interface{}{path: value})
+
+	return fmt.Sprintf("(%s @> %s::jsonb OR %s @> %s::jsonb)",
+		c.column, c.arg(string(nestedJSON)), c.column, c.arg(string(flatJSON)))
+}
+
+func (c *sqlCompiler) comparison(n *compareNode) string {
+	switch n.op {
+	case "==":
+		return c.equal(n.field, n.value)
+	case "!=":
+		return fmt.Sprintf("(NOT %s)", c.equal(n.field, n.value))
+	case "^=":
+		field := c.field(n.field)
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(%s) = 'string' THEN starts_with(%s #>> '{}', %s) ELSE FALSE END",
+			field, field, c.arg(n.value))
+	}
+
+	// Ordering comparisons on numbers or strings; values of any other
+	// type never match. CASE guarantees the type check runs before the
+	// cast, which AND does not.
+	field := c.field(n.field)
+	switch value := n.value.(type) {
+	case float64:
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(%s) = 'number' THEN (%s)::numeric %s %s::numeric ELSE FALSE END",
+			field, field, n.op, c.arg(value))
+	default:
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(%s) = 'string' THEN (%s #>> '{}') %s %s::text ELSE FALSE END",
+			field, field, n.op, c.arg(value))
+	}
+}
@@ -0,0 +1,149 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSQL(t *testing.T) {
+	// The JSONB value of the first field compiled without prior arguments
+	const field = "COALESCE(data #> $1::text[], data -> $2::text)"
+
+	tests := []struct {
+		name     string
+		expr     string
+		args     []interface{} // Arguments already in the query
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "equal top-level field",
+			expr:     `error == 0`,
+			wantSQL:  `data @> $1::jsonb`,
+			wantArgs: []interface{}{`{"error":0}`},
+		},
+		{
+			name:     "equal nested field matches both layouts",
+			expr:     `dst.port == 5432`,
+			wantSQL:  `(data @> $1::jsonb OR data @> $2::jsonb)`,
+			wantArgs: []interface{}{`{"dst":{"port":5432}}`, `{"dst.port":5432}`},
+		},
+		{
+			name:     "not equal",
+			expr:     `comm != "curl"`,
+			wantSQL:  `(NOT data @> $1::jsonb)`,
+			wantArgs: []interface{}{`{"comm":"curl"}`},
+		},
+		{
+			name:     "equal null",
+			expr:     `error == null`,
+			wantSQL:  "COALESCE(jsonb_typeof(" + field + ") = 'null', FALSE)",
+			wantArgs: []interface{}{[]string{"error"}, "error"},
+		},
+		{
+			name:     "numeric ordering",
+			expr:     `latency >= 100`,
+			wantSQL:  "CASE WHEN jsonb_typeof(" + field + ") = 'number' THEN (" + field + ")::numeric >= $3::numeric ELSE FALSE END",
+			wantArgs: []interface{}{[]string{"latency"}, "latency", 100.0},
+		},
+		{
+			name:     "string ordering",
+			expr:     `k8s.namespace < "m"`,
+			wantSQL:  "CASE WHEN jsonb_typeof(" + field + ") = 'string' THEN (" + field + " #>> '{}') < $3::text ELSE FALSE END",
+			wantArgs: []interface{}{[]string{"k8s", "namespace"}, "k8s.namespace", "m"},
+		},
+		{
+			name:     "prefix",
+			expr:     `comm ^= "kube"`,
+			wantSQL:  "CASE WHEN jsonb_typeof(" + field + ") = 'string' THEN starts_with(" + field + " #>> '{}', $3) ELSE FALSE END",
+			wantArgs: []interface{}{[]string{"comm"}, "comm", "kube"},
+		},
+		{
+			name:     "exists",
+			expr:     `exists(args)`,
+			wantSQL:  "(" + field + " IS NOT NULL)",
+			wantArgs: []interface{}{[]string{"args"}, "args"},
+		},
+		{
+			name:     "in",
+			expr:     `pid in [1, 2]`,
+			wantSQL:  `(data @> $1::jsonb OR data @> $2::jsonb)`,
+			wantArgs: []interface{}{`{"pid":1}`, `{"pid":2}`},
+		},
+		{
+			name:     "empty in",
+			expr:     `pid in []`,
+			wantSQL:  `FALSE`,
+			wantArgs: nil,
+		},
+		{
+			name:     "placeholders follow existing arguments",
+			expr:     `!(error == 0) && pid > 1 || comm == "sh"`,
+			args:     []interface{}{"session"},
+			wantSQL:  "(((NOT data @> $2::jsonb) AND CASE WHEN jsonb_typeof(COALESCE(data #> $3::text[], data -> $4::text)) = 'number' THEN (COALESCE(data #> $3::text[], data -> $4::text))::numeric > $5::numeric ELSE FALSE END) OR data @> $6::jsonb)",
+			wantArgs: []interface{}{"session", `{"error":0}`, []string{"pid"}, "pid", 1.0, `{"comm":"sh"}`},
+		},
+		{
+			name:     "quotes in an equality value stay in the arguments",
+			expr:     `comm == "x'); DROP TABLE gadget_events; --"`,
+			wantSQL:  `data @> $1::jsonb`,
+			wantArgs: []interface{}{`{"comm":"x'); DROP TABLE gadget_events; --"}`},
+		},
+		{
+			name:     "quotes in a prefix value stay in the arguments",
+			expr:     `comm ^= "' OR '1'='1"`,
+			wantSQL:  "CASE WHEN jsonb_typeof(" + field + ") = 'string' THEN starts_with(" + field + " #>> '{}', $3) ELSE FALSE END",
+			wantArgs: []interface{}{[]string{"comm"}, "comm", "' OR '1'='1"},
+		},
+		{
+			name:     "quotes in an ordering value stay in the arguments",
+			expr:     `name > "a' OR TRUE --"`,
+			wantSQL:  "CASE WHEN jsonb_typeof(" + field + ") = 'string' THEN (" + field + " #>> '{}') > $3::text ELSE FALSE END",
+			wantArgs: []interface{}{[]string{"name"}, "name", "a' OR TRUE --"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+
+			sql, args := expr.SQL("data", tt.args)
+			if sql != tt.wantSQL {
+				t.Errorf("SQL(%q)\n got: %s\nwant: %s", tt.expr, sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("SQL(%q) args\n got: %#v\nwant: %#v", tt.expr, args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// Field names end up in the SQL only as arguments, and anything that isn't
+// an identifier is rejected before compiling
+func TestSQLRejectsInjectedFields(t *testing.T) {
+	for _, expr := range []string{
+		`comm'; DROP TABLE gadget_events; -- == 1`,
+		`comm == 1; DROP TABLE gadget_events`,
+		`comm == 1 -- comment`,
+		`"comm" == 1`,
+		`comm == 'sh'`,
+		`exists(comm) OR 1=1`,
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+
+	expr, err := Parse(`k8s.namespace == "a"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := expr.SQL("data", nil)
+	if strings.Contains(sql, "namespace") {
+		t.Errorf("field name inlined into SQL: %s", sql)
+	}
+}
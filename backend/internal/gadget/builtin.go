@@ -0,0 +1,139 @@
+package gadget
+
+import "inspector-gadget-management/backend/internal/models"
+
+// builtinGadgets lists the gadgets registered by DefaultRegistry
+var builtinGadgets = []Definition{
+	{
+		Type:              models.GadgetTraceSNI,
+		Name:              "Trace SNI",
+		Description:       "Trace TLS Server Name Indication from TLS requests",
+		Category:          "trace",
+		Image:             "trace_sni:latest",
+		OutputMode:        OutputStreaming,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+	},
+	{
+		Type:              models.GadgetTraceTCP,
+		Name:              "Trace TCP",
+		Description:       "Trace TCP connections",
+		Category:          "trace",
+		Image:             "trace_tcp:latest",
+		OutputMode:        OutputStreaming,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params: []ParamSpec{
+			{Name: "acceptOnly", Type: "bool", Flag: "--accept-only", Description: "Only show accept events"},
+			{Name: "connectOnly", Type: "bool", Flag: "--connect-only", Description: "Only show connect events"},
+			{Name: "failureOnly", Type: "bool", Flag: "--failure-only", Description: "Only show failed connections"},
+		},
+	},
+	{
+		Type:              models.GadgetSnapshotProc,
+		Name:              "Snapshot Process",
+		Description:       "Gather information about running processes",
+		Category:          "snapshot",
+		Image:             "snapshot_process:latest",
+		OutputMode:        OutputSnapshot,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+	},
+	{
+		Type:              models.GadgetSnapshotSocket,
+		Name:              "Snapshot Socket",
+		Description:       "Gather information about TCP and UDP sockets",
+		Category:          "snapshot",
+		Image:             "snapshot_socket:latest",
+		OutputMode:        OutputSnapshot,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+	},
+	{
+		Type:              models.GadgetTraceDNS,
+		Name:              "Trace DNS",
+		Description:       "Trace DNS queries and responses",
+		Category:          "trace",
+		Image:             "trace_dns:latest",
+		OutputMode:        OutputStreaming,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params: []ParamSpec{
+			{Name: "qtype", Type: "string", Filter: "qtype==%s", Description: "Only show queries of this type",
+				Allowed: []string{"A", "AAAA", "CNAME", "MX", "NS", "PTR", "SOA", "SRV", "TXT", "ANY"}},
+			{Name: "name", Type: "string", Filter: "name~%s", Description: "Regular expression matched against the queried name"},
+		},
+	},
+	{
+		Type:              models.GadgetTraceExec,
+		Name:              "Trace Exec",
+		Description:       "Trace new processes and their arguments",
+		Category:          "trace",
+		Image:             "trace_exec:latest",
+		OutputMode:        OutputStreaming,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params: []ParamSpec{
+			{Name: "paths", Type: "bool", Flag: "--paths", Description: "Capture the working directory and executable path"},
+			{Name: "ignoreFailed", Type: "bool", Flag: "--ignore-failed", Description: "Ignore failed exec calls"},
+			{Name: "comm", Type: "string", Filter: "comm==%s", Description: "Only show processes with this command name"},
+		},
+	},
+	{
+		Type:              models.GadgetTraceOpen,
+		Name:              "Trace Open",
+		Description:       "Trace files opened by processes",
+		Category:          "trace",
+		Image:             "trace_open:latest",
+		OutputMode:        OutputStreaming,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params: []ParamSpec{
+			{Name: "path", Type: "string", Filter: "fname~%s", Description: "Regular expression matched against the opened path"},
+			{Name: "failedOnly", Type: "bool", Filter: "error!=0", Description: "Only show failed opens"},
+		},
+	},
+	{
+		Type:              models.GadgetTopTCP,
+		Name:              "Top TCP",
+		Description:       "Periodically report TCP send and receive activity",
+		Category:          "top",
+		Image:             "top_tcp:latest",
+		OutputMode:        OutputInterval,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params:            topParams,
+	},
+	{
+		Type:              models.GadgetTopFile,
+		Name:              "Top File",
+		Description:       "Periodically report read and write activity by file",
+		Category:          "top",
+		Image:             "top_file:latest",
+		OutputMode:        OutputInterval,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params:            topParams,
+	},
+	{
+		Type:              models.GadgetTopBlockIO,
+		Name:              "Top Block I/O",
+		Description:       "Periodically report block device I/O activity",
+		Category:          "top",
+		Image:             "top_block_io:latest",
+		OutputMode:        OutputInterval,
+		SupportsNamespace: true,
+		SupportsPodName:   true,
+		Params:            topParams,
+	},
+}
+
+// topParams are the parameters shared by all top gadgets. The ebpf operator
+// fetches their maps every --map-fetch-interval, and the limiter operator
+// keeps the first --max-entries rows of each fetch.
+var topParams = []ParamSpec{
+	{Name: "interval", Type: "int", Flag: "--map-fetch-interval", Unit: "s", Description: "Seconds between frames",
+		Default: int64(1), Min: intPtr(1), Max: intPtr(300)},
+	{Name: "maxRows", Type: "int", Flag: "--max-entries", ServiceParam: "operator.limiter.max-entries",
+		Description: "Maximum number of rows per frame", Default: int64(20), Min: intPtr(1), Max: intPtr(1000)},
+}
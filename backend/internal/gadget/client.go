@@ -5,47 +5,84 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"inspector-gadget-management/backend/internal/filter"
 	"inspector-gadget-management/backend/internal/models"
 )
 
 // Client manages gadget operations
 type Client struct {
 	mu               sync.RWMutex
+	registry         *Registry
+	runner           Runner
 	sessions         map[string]*Session
 	sessionEndedFunc func(sessionID string, reason string) // Callback when session ends
+	maxTimeout       time.Duration                         // Upper bound for per-session timeouts
 }
 
 // Session represents an active gadget session
 type Session struct {
 	ID          string
 	Type        models.GadgetType
+	OutputMode  OutputMode
 	Namespace   string
 	PodName     string
-	Cmd         *exec.Cmd
+	Process     Process
 	Cancel      context.CancelFunc
 	OutputCh    chan models.GadgetOutput
 	ErrorCh     chan error
-	Status      string
 	StartTime   time.Time
 	Timeout     time.Duration
+	Params      map[string]interface{}
+	Request     models.GadgetRequest // Original request the session was started with
 	// TCP trace specific options
 	AcceptOnly  bool
 	ConnectOnly bool
 	FailureOnly bool
+	Counters    Counters
+	// Overflow settings, also applied to the session's WebSocket clients
+	OverflowPolicy OverflowPolicy
+	SampleRate     int
+	overflow       *Overflow    // Output channel overflow state
+	filter         *filter.Expr // Events not matching are discarded
+
+	// Status and deadline handling, guarded by mu. Pinned sessions have no
+	// deadline and run until explicitly stopped.
+	mu       sync.Mutex
+	status   string
+	deadline time.Time
+	pinned   bool
+	resetCh  chan struct{} // Wakes the timeout watcher after a deadline change
 }
 
-// NewClient creates a new gadget client
+// NewClient creates a new gadget client with the built-in gadgets
 func NewClient() *Client {
+	return NewClientWithRegistry(DefaultRegistry())
+}
+
+// NewClientWithRegistry creates a new gadget client backed by the given registry
+func NewClientWithRegistry(registry *Registry) *Client {
 	return &Client{
-		sessions: make(map[string]*Session),
+		registry:   registry,
+		runner:     &KubectlRunner{},
+		sessions:   make(map[string]*Session),
+		maxTimeout: DefaultMaxTimeout,
 	}
 }
 
+// Registry returns the gadget registry used by the client
+func (c *Client) Registry() *Registry {
+	return c.registry
+}
+
+// SetRunner sets the runner used to start gadgets (kubectl-gadget by default)
+func (c *Client) SetRunner(runner Runner) {
+	c.runner = runner
+}
+
 // SetSessionEndedCallback sets the callback function that's called when a session ends
 func (c *Client) SetSessionEndedCallback(fn func(sessionID string, reason string)) {
 	c.sessionEndedFunc = fn
@@ -55,151 +92,120 @@ func (c *Client) SetSessionEndedCallback(fn func(sessionID string, reason string
 func (c *Client) RunGadget(ctx context.Context, req models.GadgetRequest, sessionID string) (*Session, error) {
 	cmdCtx, cancel := context.WithCancel(ctx)
 
-	var args []string
-	switch req.Type {
-	case models.GadgetTraceSNI:
-		args = []string{"run", "trace_sni:latest"}
-		if req.Namespace != "" {
-			args = append(args, "-n", req.Namespace)
-		} else {
-			// When no namespace is specified, trace all namespaces
-			args = append(args, "-A")
-		}
-		if req.PodName != "" {
-			args = append(args, "--podname", req.PodName)
-		}
-		args = append(args, "-o", "json")
-
-	case models.GadgetTraceTCP:
-		args = []string{"run", "trace_tcp:latest"}
-		if req.Namespace != "" {
-			args = append(args, "-n", req.Namespace)
-		} else {
-			// When no namespace is specified, trace all namespaces
-			args = append(args, "-A")
-		}
-		if req.PodName != "" {
-			args = append(args, "--podname", req.PodName)
-		}
-		// Add TCP trace flags
-		if req.AcceptOnly {
-			args = append(args, "--accept-only")
-		}
-		if req.ConnectOnly {
-			args = append(args, "--connect-only")
-		}
-		if req.FailureOnly {
-			args = append(args, "--failure-only")
-		}
-		args = append(args, "-o", "json")
-
-	case models.GadgetSnapshotProc:
-		args = []string{"run", "snapshot_process:latest"}
-		if req.Namespace != "" {
-			args = append(args, "-n", req.Namespace)
-		} else {
-			// When no namespace is specified, trace all namespaces
-			args = append(args, "-A")
-		}
-		if req.PodName != "" {
-			args = append(args, "--podname", req.PodName)
-		}
-		args = append(args, "-o", "json")
-
-	case models.GadgetSnapshotSocket:
-		args = []string{"run", "snapshot_socket:latest"}
-		if req.Namespace != "" {
-			args = append(args, "-n", req.Namespace)
-		} else {
-			// When no namespace is specified, trace all namespaces
-			args = append(args, "-A")
-		}
-		if req.PodName != "" {
-			args = append(args, "--podname", req.PodName)
-		}
-		args = append(args, "-o", "json")
-
-	default:
+	def, ok := c.registry.Lookup(req.Type)
+	if !ok {
 		cancel()
-		return nil, fmt.Errorf("unsupported gadget type: %s", req.Type)
-	}
-
-	cmd := exec.CommandContext(cmdCtx, "kubectl-gadget", args...)
-
-	session := &Session{
-		ID:          sessionID,
-		Type:        req.Type,
-		Namespace:   req.Namespace,
-		PodName:     req.PodName,
-		Cmd:         cmd,
-		Cancel:      cancel,
-		OutputCh:    make(chan models.GadgetOutput, 100),
-		ErrorCh:     make(chan error, 10),
-		Status:      "running",
-		StartTime:   time.Now(),
-		Timeout:     30 * time.Minute, // Default 30 minute timeout
-		AcceptOnly:  req.AcceptOnly,
-		ConnectOnly: req.ConnectOnly,
-		FailureOnly: req.FailureOnly,
+		return nil, &ValidationError{Field: "type", Message: fmt.Sprintf("unsupported gadget type: %s", req.Type)}
 	}
-
-	stdout, err := cmd.StdoutPipe()
+	params, err := def.ResolveParams(req)
 	if err != nil {
 		cancel()
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+		return nil, err
 	}
-
-	stderr, err := cmd.StderrPipe()
+	timeout, err := c.resolveTimeout(req.TimeoutSeconds)
 	if err != nil {
 		cancel()
-		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+		return nil, err
+	}
+	if err := ValidateOverflow(OverflowPolicy(req.OverflowPolicy), req.SampleRate); err != nil {
+		cancel()
+		return nil, err
+	}
+	overflow := NewOverflow(OverflowPolicy(req.OverflowPolicy), req.SampleRate)
+	var eventFilter *filter.Expr
+	if req.Filter != "" {
+		eventFilter, err = filter.Parse(req.Filter)
+		if err != nil {
+			cancel()
+			return nil, &ValidationError{Field: "filter", Message: err.Error()}
+		}
+	}
+	spec := RunSpec{
+		Definition: def,
+		Request:    req,
+		Params:     params,
+		Args:       def.BuildArgs(req, params),
 	}
 
-	if err := cmd.Start(); err != nil {
+	process, err := c.runner.Start(cmdCtx, spec)
+	if err != nil {
 		cancel()
-		return nil, fmt.Errorf("failed to start gadget: %w", err)
+		return nil, err
 	}
 
-	// Log command start
-	fmt.Printf("Started gadget: kubectl-gadget %v\n", args)
+	startTime := time.Now()
+	session := &Session{
+		ID:             sessionID,
+		Type:           req.Type,
+		OutputMode:     def.OutputMode,
+		Namespace:      req.Namespace,
+		PodName:        req.PodName,
+		Process:        process,
+		Cancel:         cancel,
+		OutputCh:       make(chan models.GadgetOutput, 100),
+		ErrorCh:        make(chan error, 10),
+		status:         "running",
+		StartTime:      startTime,
+		Timeout:        timeout,
+		Params:         params,
+		Request:        req,
+		AcceptOnly:     req.AcceptOnly,
+		ConnectOnly:    req.ConnectOnly,
+		FailureOnly:    req.FailureOnly,
+		OverflowPolicy: overflow.Policy,
+		SampleRate:     overflow.SampleRate,
+		overflow:       overflow,
+		filter:         eventFilter,
+		deadline:       startTime.Add(timeout),
+		pinned:         req.Pinned,
+		resetCh:        make(chan struct{}, 1),
+	}
 
 	c.mu.Lock()
 	c.sessions[sessionID] = session
 	c.mu.Unlock()
 
-	// Handle stdout
-	go c.handleOutput(session, stdout)
-
-	// Handle stderr
-	go c.handleErrors(session, stderr)
+	// Handle stdout and stderr. Both must be fully read before waiting for
+	// the process, and before the session channels are closed.
+	var readers sync.WaitGroup
+	readers.Add(2)
+	if source, ok := process.(EventSource); ok {
+		// Runner delivers decoded events, no output parsing needed
+		go func() {
+			defer readers.Done()
+			c.handleEvents(session, source.Events())
+		}()
+		go func() {
+			defer readers.Done()
+			for err := range source.Errors() {
+				session.reportError(err)
+			}
+		}()
+	} else {
+		go func() {
+			defer readers.Done()
+			stdout := process.Stdout()
+			c.handleOutput(session, stdout)
+			// Keep draining so the gadget never blocks on a full pipe
+			io.Copy(io.Discard, stdout)
+		}()
+		go func() {
+			defer readers.Done()
+			c.handleErrors(session, process.Stderr())
+		}()
+	}
 
 	// Start timeout timer
-	go func() {
-		timer := time.NewTimer(session.Timeout)
-		defer timer.Stop()
-
-		select {
-		case <-timer.C:
-			// Timeout reached, stop the gadget
-			fmt.Printf("Gadget session %s timed out after %v, stopping...\n", sessionID, session.Timeout)
-			c.StopGadget(sessionID)
-			// Notify cleanup handler
-			if c.sessionEndedFunc != nil {
-				c.sessionEndedFunc(sessionID, "timeout")
-			}
-		case <-cmdCtx.Done():
-			// Context cancelled before timeout
-			return
-		}
-	}()
+	go c.watchTimeout(cmdCtx, session)
 
 	// Wait for command completion
 	go func() {
-		err := cmd.Wait()
+		readers.Wait()
+		err := process.Wait()
 		reason := "completed"
 		if err != nil && cmdCtx.Err() == nil {
 			fmt.Printf("Gadget exited with error: %v\n", err)
-			session.ErrorCh <- fmt.Errorf("gadget exited with error: %w", err)
+			session.reportError(fmt.Errorf("gadget exited with error: %w", err))
 			reason = "error"
 		} else if cmdCtx.Err() != nil {
 			if cmdCtx.Err() == context.DeadlineExceeded {
@@ -212,7 +218,7 @@ func (c *Client) RunGadget(ctx context.Context, req models.GadgetRequest, sessio
 		} else {
 			fmt.Printf("Gadget exited normally\n")
 		}
-		session.Status = "stopped"
+		session.setStatus("stopped")
 		close(session.OutputCh)
 		close(session.ErrorCh)
 
@@ -233,9 +239,12 @@ func (c *Client) RunGadget(ctx context.Context, req models.GadgetRequest, sessio
 // handleOutput processes gadget output
 func (c *Client) handleOutput(session *Session, reader io.Reader) {
 	// Snapshot gadgets return a JSON array, trace gadgets return JSON objects
-	if session.Type == models.GadgetSnapshotProc || session.Type == models.GadgetSnapshotSocket {
+	switch session.OutputMode {
+	case OutputSnapshot:
 		c.handleSnapshotOutput(session, reader)
-	} else {
+	case OutputInterval:
+		c.handleIntervalOutput(session, reader)
+	default:
 		c.handleStreamingOutput(session, reader)
 	}
 }
@@ -248,7 +257,7 @@ func (c *Client) handleStreamingOutput(session *Session, reader io.Reader) {
 		var rawData map[string]interface{}
 		if err := decoder.Decode(&rawData); err != nil {
 			if err != io.EOF {
-				session.ErrorCh <- fmt.Errorf("failed to decode output: %w", err)
+				session.reportError(fmt.Errorf("failed to decode output: %w", err))
 			}
 			return
 		}
@@ -260,11 +269,7 @@ func (c *Client) handleStreamingOutput(session *Session, reader io.Reader) {
 			EventType: string(session.Type),
 		}
 
-		select {
-		case session.OutputCh <- output:
-		default:
-			// Channel full, skip event
-		}
+		session.emit(output)
 	}
 }
 
@@ -275,7 +280,7 @@ func (c *Client) handleSnapshotOutput(session *Session, reader io.Reader) {
 	var rawArray []map[string]interface{}
 	if err := decoder.Decode(&rawArray); err != nil {
 		if err != io.EOF {
-			session.ErrorCh <- fmt.Errorf("failed to decode snapshot output: %w", err)
+			session.reportError(fmt.Errorf("failed to decode snapshot output: %w", err))
 		}
 		return
 	}
@@ -289,16 +294,87 @@ func (c *Client) handleSnapshotOutput(session *Session, reader io.Reader) {
 			EventType: string(session.Type),
 		}
 
-		select {
-		case session.OutputCh <- output:
-		default:
-			// Channel full, skip event
-		}
+		session.emit(output)
 	}
 
 	fmt.Printf("Snapshot gadget returned %d items\n", len(rawArray))
 }
 
+// handleIntervalOutput processes interval gadget output (top gadgets).
+// Each JSON array on stdout is one frame; every row is tagged with the
+// frame sequence number and the time the frame was received.
+func (c *Client) handleIntervalOutput(session *Session, reader io.Reader) {
+	decoder := json.NewDecoder(reader)
+
+	var frame int64
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err != io.EOF {
+				session.reportError(fmt.Errorf("failed to decode interval output: %w", err))
+			}
+			return
+		}
+
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			// Some gadgets emit a single object when only one row is present
+			var row map[string]interface{}
+			if err := json.Unmarshal(raw, &row); err != nil {
+				session.reportError(fmt.Errorf("failed to decode interval frame: %w", err))
+				continue
+			}
+			rows = []map[string]interface{}{row}
+		}
+
+		frame++
+		frameTime := time.Now()
+
+		for _, rawData := range rows {
+			output := models.GadgetOutput{
+				SessionID: session.ID,
+				Timestamp: frameTime,
+				Data:      rawData,
+				EventType: string(session.Type),
+				Frame:     frame,
+				FrameTime: &frameTime,
+			}
+
+			session.emit(output)
+		}
+	}
+}
+
+// handleEvents processes decoded events from an EventSource. Each batch is
+// one event, one snapshot or one frame depending on the output mode.
+func (c *Client) handleEvents(session *Session, events <-chan []map[string]interface{}) {
+	var frame int64
+	for batch := range events {
+		now := time.Now()
+
+		var frameTime *time.Time
+		if session.OutputMode == OutputInterval {
+			frame++
+			frameTime = &now
+		}
+
+		for _, rawData := range batch {
+			output := models.GadgetOutput{
+				SessionID: session.ID,
+				Timestamp: now,
+				Data:      rawData,
+				EventType: string(session.Type),
+			}
+			if frameTime != nil {
+				output.Frame = frame
+				output.FrameTime = frameTime
+			}
+
+			session.emit(output)
+		}
+	}
+}
+
 // handleErrors processes gadget errors
 func (c *Client) handleErrors(session *Session, reader io.Reader) {
 	buf := make([]byte, 4096)
@@ -308,7 +384,7 @@ func (c *Client) handleErrors(session *Session, reader io.Reader) {
 			errMsg := strings.TrimSpace(string(buf[:n]))
 			if errMsg != "" {
 				fmt.Printf("Gadget stderr: %s\n", errMsg)
-				session.ErrorCh <- fmt.Errorf("gadget error: %s", errMsg)
+				session.reportError(fmt.Errorf("gadget error: %s", errMsg))
 			}
 		}
 		if err != nil {
@@ -320,6 +396,16 @@ func (c *Client) handleErrors(session *Session, reader io.Reader) {
 	}
 }
 
+// reportError forwards an error to the session's error channel without
+// blocking the output readers when nobody is consuming errors
+func (s *Session) reportError(err error) {
+	select {
+	case s.ErrorCh <- err:
+	default:
+		fmt.Printf("Dropping gadget error for session %s: %v\n", s.ID, err)
+	}
+}
+
 // StopGadget stops a running gadget session
 func (c *Client) StopGadget(sessionID string) error {
 	c.mu.Lock()
@@ -332,11 +418,55 @@ func (c *Client) StopGadget(sessionID string) error {
 	c.mu.Unlock()
 
 	session.Cancel()
-	session.Status = "stopped"
+	session.setStatus("stopped")
 
 	return nil
 }
 
+// Status returns "running", or "stopped" once the gadget was stopped or
+// exited
+func (s *Session) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Session) setStatus(status string) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+// Info returns the API representation of the session
+func (s *Session) Info() models.GadgetSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req := s.Request
+	counters := s.Counters.Snapshot()
+	info := models.GadgetSession{
+		ID:          s.ID,
+		Type:        s.Type,
+		Namespace:   s.Namespace,
+		PodName:     s.PodName,
+		StartTime:   s.StartTime,
+		Status:      s.status,
+		Timeout:     s.Timeout,
+		Pinned:      s.pinned,
+		Params:      s.Params,
+		Request:     &req,
+		Counters:    &counters,
+		AcceptOnly:  s.AcceptOnly,
+		ConnectOnly: s.ConnectOnly,
+		FailureOnly: s.FailureOnly,
+	}
+	if !s.pinned {
+		deadline := s.deadline
+		info.Deadline = &deadline
+	}
+	return info
+}
+
 // GetSession retrieves a session by ID
 func (c *Client) GetSession(sessionID string) (*Session, bool) {
 	c.mu.RLock()
@@ -352,18 +482,7 @@ func (c *Client) ListSessions() []models.GadgetSession {
 
 	sessions := make([]models.GadgetSession, 0, len(c.sessions))
 	for _, s := range c.sessions {
-		sessions = append(sessions, models.GadgetSession{
-			ID:          s.ID,
-			Type:        s.Type,
-			Namespace:   s.Namespace,
-			PodName:     s.PodName,
-			StartTime:   s.StartTime,
-			Status:      s.Status,
-			Timeout:     s.Timeout,
-			AcceptOnly:  s.AcceptOnly,
-			ConnectOnly: s.ConnectOnly,
-			FailureOnly: s.FailureOnly,
-		})
+		sessions = append(sessions, s.Info())
 	}
 	return sessions
 }
@@ -0,0 +1,50 @@
+package gadget
+
+import (
+	"sync/atomic"
+
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// Counters tracks how many events a session produced and where any were
+// lost, so users can tell whether a trace is complete
+type Counters struct {
+	Received      atomic.Int64 // Events read from the gadget
+	Filtered      atomic.Int64 // Events excluded by the session's filter
+	Dropped       atomic.Int64 // Events dropped because the output channel was full
+	Sampled       atomic.Int64 // Events skipped by sampling at the output channel
+	ClientDropped atomic.Int64 // Events dropped or sampled at WebSocket client send buffers, summed over clients
+	PersistFailed atomic.Int64 // Events that could not be published to storage
+}
+
+// Snapshot returns the current counter values
+func (c *Counters) Snapshot() models.SessionCounters {
+	return models.SessionCounters{
+		Received:      c.Received.Load(),
+		Filtered:      c.Filtered.Load(),
+		Dropped:       c.Dropped.Load(),
+		Sampled:       c.Sampled.Load(),
+		ClientDropped: c.ClientDropped.Load(),
+		PersistFailed: c.PersistFailed.Load(),
+	}
+}
+
+// emit sends an event to the session's output channel, applying the
+// session's filter and overflow policy and counting lost events
+func (s *Session) emit(output models.GadgetOutput) {
+	s.Counters.Received.Add(1)
+
+	if s.filter != nil && !s.filter.Match(output.Data) {
+		s.Counters.Filtered.Add(1)
+		return
+	}
+
+	// The output channel is always drained until it is closed, so blocking
+	// needs no way out
+	switch Deliver(s.overflow, s.OutputCh, output, nil) {
+	case Dropped:
+		s.Counters.Dropped.Add(1)
+	case Sampled:
+		s.Counters.Sampled.Add(1)
+	}
+}
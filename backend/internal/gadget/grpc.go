@@ -0,0 +1,269 @@
+package gadget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"inspector-gadget-management/backend/internal/gadget/igapi"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// grpcStopTimeout bounds how long a stopped gadget may keep streaming
+const grpcStopTimeout = 5 * time.Second
+
+// GadgetError is an error reported by the Inspektor Gadget gadget service,
+// either as a gRPC status or as an error level log event from the gadget
+type GadgetError struct {
+	Code    codes.Code // codes.Unknown for gadget log events
+	Message string
+}
+
+func (e *GadgetError) Error() string {
+	if e.Code == codes.Unknown {
+		return fmt.Sprintf("gadget error: %s", e.Message)
+	}
+	return fmt.Sprintf("gadget service error (%s): %s", e.Code, e.Message)
+}
+
+// EventSource is implemented by processes that deliver decoded events
+// directly instead of writing JSON to stdout
+type EventSource interface {
+	// Events yields one batch per gadget payload: a single event for
+	// streaming gadgets, all rows of a snapshot or frame otherwise.
+	// It is closed when the gadget finishes.
+	Events() <-chan []map[string]interface{}
+	// Errors yields errors reported while the gadget runs.
+	// It is closed when the gadget finishes.
+	Errors() <-chan error
+}
+
+// GRPCRunner runs gadgets through the Inspektor Gadget gadget service API
+// instead of spawning a kubectl-gadget process per session
+type GRPCRunner struct {
+	// Addr is the gadget service address, in any form accepted by gRPC
+	// (e.g. "gadget-service:8080" or "unix:///run/gadgetservice.sock")
+	Addr string
+
+	once    sync.Once
+	conn    *grpc.ClientConn
+	connErr error
+}
+
+// Start runs the spec's gadget image on the gadget service
+func (r *GRPCRunner) Start(ctx context.Context, spec RunSpec) (Process, error) {
+	r.once.Do(func() {
+		r.conn, r.connErr = grpc.Dial(r.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	})
+	if r.connErr != nil {
+		return nil, fmt.Errorf("failed to connect to gadget service: %w", r.connErr)
+	}
+
+	// The stream outlives ctx so the gadget can be stopped gracefully
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	stream, err := igapi.RunGadget(streamCtx, r.conn, igapi.GadgetRunRequest{
+		ImageName:   spec.Definition.Image,
+		ParamValues: grpcParamValues(spec),
+		Version:     igapi.APIVersion,
+	})
+	if err != nil {
+		cancelStream()
+		return nil, fmt.Errorf("failed to start gadget: %w", toGadgetError(err))
+	}
+
+	fmt.Printf("Started gadget %s via gadget service at %s\n", spec.Definition.Image, r.Addr)
+
+	process := &grpcProcess{
+		events: make(chan []map[string]interface{}, 100),
+		errors: make(chan error, 10),
+		done:   make(chan error, 1),
+	}
+
+	finished := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			// The gadget ended on its own
+			return
+		}
+		if err := stream.Stop(); err != nil {
+			cancelStream()
+			return
+		}
+		// Give the gadget a moment to flush, then tear the stream down
+		time.AfterFunc(grpcStopTimeout, cancelStream)
+	}()
+
+	go func() {
+		defer cancelStream()
+		defer close(finished)
+		err := process.receive(stream)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		close(process.events)
+		close(process.errors)
+		process.done <- err
+	}()
+
+	return process, nil
+}
+
+// Close closes the connection to the gadget service
+func (r *GRPCRunner) Close() error {
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
+}
+
+// grpcParamValues translates a run spec into gadget service parameters
+func grpcParamValues(spec RunSpec) map[string]string {
+	values := make(map[string]string)
+
+	req := spec.Request
+	if spec.Definition.SupportsNamespace {
+		if req.Namespace != "" {
+			values["operator.KubeManager.namespace"] = req.Namespace
+		} else {
+			values["operator.KubeManager.all-namespaces"] = "true"
+		}
+	}
+	if spec.Definition.SupportsPodName && req.PodName != "" {
+		values["operator.KubeManager.podname"] = req.PodName
+	}
+
+	var filters []string
+	for _, param := range spec.Definition.Params {
+		value, ok := spec.Params[param.Name]
+		if !ok {
+			continue
+		}
+
+		switch v := value.(type) {
+		case bool:
+			if !v {
+				continue
+			}
+			if param.Filter != "" {
+				filters = append(filters, param.Filter)
+			} else {
+				values[grpcParamKey(param)] = "true"
+			}
+		case string:
+			if v == "" {
+				continue
+			}
+			if param.Filter != "" {
+				filters = append(filters, fmt.Sprintf(param.Filter, v))
+			} else {
+				values[grpcParamKey(param)] = v
+			}
+		case int64:
+			values[grpcParamKey(param)] = param.flagValue(v)
+		}
+	}
+	if len(filters) > 0 {
+		values["operator.filter.filter"] = strings.Join(filters, ",")
+	}
+
+	return values
+}
+
+// grpcParamKey maps a param to its gadget service parameter. Gadget
+// parameters belong to the ebpf operator, under the name of their flag.
+func grpcParamKey(param ParamSpec) string {
+	if param.ServiceParam != "" {
+		return param.ServiceParam
+	}
+	return "operator.oci.ebpf." + strings.TrimLeft(param.Flag, "-")
+}
+
+// grpcProcess is the Process returned by GRPCRunner. It implements
+// EventSource, so stdout and stderr are always empty.
+type grpcProcess struct {
+	events chan []map[string]interface{}
+	errors chan error
+	done   chan error
+}
+
+func (p *grpcProcess) Stdout() io.Reader                       { return strings.NewReader("") }
+func (p *grpcProcess) Stderr() io.Reader                       { return strings.NewReader("") }
+func (p *grpcProcess) Wait() error                             { return <-p.done }
+func (p *grpcProcess) Events() <-chan []map[string]interface{} { return p.events }
+func (p *grpcProcess) Errors() <-chan error                    { return p.errors }
+
+// receive reads gadget events until the gadget is done. Payloads are
+// decoded with the data source layouts of the gadget info sent first.
+func (p *grpcProcess) receive(stream *igapi.RunStream) error {
+	var info *igapi.GadgetInfo
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return toGadgetError(err)
+		}
+
+		if level, ok := event.LogLevel(); ok {
+			if level <= igapi.LogLevelWarn {
+				p.reportError(&GadgetError{Code: codes.Unknown, Message: string(event.Payload)})
+			}
+			continue
+		}
+
+		switch event.EventType() {
+		case igapi.EventTypeGadgetInfo:
+			info, err = igapi.UnmarshalGadgetInfo(event.Payload)
+			if err != nil {
+				return fmt.Errorf("failed to decode gadget info: %w", err)
+			}
+		case igapi.EventTypeGadgetPayload, igapi.EventTypeGadgetResult:
+			if info == nil {
+				p.reportError(errors.New("gadget payload received before the gadget info"))
+				continue
+			}
+			dataSource, ok := info.DataSource(event.DataSourceID)
+			if !ok {
+				p.reportError(fmt.Errorf("gadget payload for unknown data source %d", event.DataSourceID))
+				continue
+			}
+			batch, err := dataSource.DecodePayload(event.Payload)
+			if err != nil {
+				p.reportError(fmt.Errorf("failed to decode gadget payload: %w", err))
+				continue
+			}
+			p.events <- batch
+		case igapi.EventTypeGadgetDone:
+			return nil
+		}
+	}
+}
+
+// reportError forwards an error without blocking event delivery
+func (p *grpcProcess) reportError(err error) {
+	select {
+	case p.errors <- err:
+	default:
+		fmt.Printf("Dropping gadget error: %v\n", err)
+	}
+}
+
+// toGadgetError converts a gRPC status error into a GadgetError
+func toGadgetError(err error) error {
+	if st, ok := status.FromError(err); ok {
+		return &GadgetError{Code: st.Code(), Message: st.Message()}
+	}
+	return err
+}
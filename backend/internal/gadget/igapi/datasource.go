@@ -0,0 +1,351 @@
+package igapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Data source types, as in DataSource.Type
+const (
+	DataSourceTypeUndefined uint32 = iota
+	DataSourceTypeSingle           // payloads are GadgetData, one event each
+	DataSourceTypeArray            // payloads are GadgetDataArray, e.g. snapshots and frames
+)
+
+// Field kinds, as in Field.Kind
+const (
+	KindInvalid uint32 = iota
+	KindBool
+	KindInt8
+	KindInt16
+	KindInt32
+	KindInt64
+	KindUint8
+	KindUint16
+	KindUint32
+	KindUint64
+	KindFloat32
+	KindFloat64
+	KindString
+	KindCString
+	KindBytes
+)
+
+// Field flags, as in Field.Flags
+const (
+	FieldFlagEmpty     uint32 = 1 << iota // has no value of its own
+	FieldFlagContainer                    // only groups its child fields
+	FieldFlagHidden                       // not shown by default
+	FieldFlagHasParent
+	FieldFlagStatic // fixed offset and size within its payload
+	FieldFlagUnreferenced
+)
+
+// GadgetInfo describes a running gadget. The gadget service sends it in an
+// EventTypeGadgetInfo event before any payload.
+type GadgetInfo struct {
+	Name        string
+	ImageName   string
+	DataSources []DataSource
+}
+
+// DataSource describes the layout of the payloads sent for one data source
+type DataSource struct {
+	ID     uint32
+	Name   string
+	Type   uint32
+	Fields []Field
+}
+
+// Field locates one value within a data source's payloads
+type Field struct {
+	Name         string
+	FullName     string // dotted path, e.g. "k8s.namespace"
+	Index        uint32
+	PayloadIndex uint32
+	Offs         uint32
+	Size         uint32 // 0 for variable size fields spanning their payload
+	Flags        uint32
+	Kind         uint32
+}
+
+// UnmarshalGadgetInfo decodes the payload of an EventTypeGadgetInfo event
+func UnmarshalGadgetInfo(b []byte) (*GadgetInfo, error) {
+	info := &GadgetInfo{}
+	err := consumeFields(b, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 1:
+			info.Name = string(raw)
+		case 2:
+			info.ImageName = string(raw)
+		case 3:
+			var ds DataSource
+			if err := ds.unmarshal(raw); err != nil {
+				return err
+			}
+			info.DataSources = append(info.DataSources, ds)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// DataSource returns the data source with the given ID
+func (i *GadgetInfo) DataSource(id uint32) (*DataSource, bool) {
+	for idx := range i.DataSources {
+		if i.DataSources[idx].ID == id {
+			return &i.DataSources[idx], true
+		}
+	}
+	return nil, false
+}
+
+// DecodePayload decodes the payload of an EventTypeGadgetPayload event of
+// this data source into events keyed like the gadget's JSON output, with
+// dotted field names nested ({"k8s": {"namespace": ...}}). Array data
+// sources yield one event per element.
+func (d *DataSource) DecodePayload(b []byte) ([]map[string]interface{}, error) {
+	var elements [][][]byte
+	err := consumeFields(b, func(num protowire.Number, v uint64, raw []byte) error {
+		// GadgetData.data and GadgetDataArray.dataArray are both field 3
+		if num != 3 {
+			return nil
+		}
+		payloads, err := unmarshalDataElement(raw)
+		if err != nil {
+			return err
+		}
+		elements = append(elements, payloads)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.Type != DataSourceTypeArray && len(elements) > 1 {
+		return nil, fmt.Errorf("data source %q: %d elements in a single event payload", d.Name, len(elements))
+	}
+
+	events := make([]map[string]interface{}, 0, len(elements))
+	for _, payloads := range elements {
+		event, err := d.decodeElement(payloads)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// decodeElement decodes the payloads of one DataElement
+func (d *DataSource) decodeElement(payloads [][]byte) (map[string]interface{}, error) {
+	event := make(map[string]interface{})
+	for _, field := range d.Fields {
+		if field.Flags&(FieldFlagEmpty|FieldFlagContainer|FieldFlagHidden) != 0 {
+			continue
+		}
+		if int(field.PayloadIndex) >= len(payloads) {
+			continue
+		}
+
+		value, err := field.decode(payloads[field.PayloadIndex])
+		if err != nil {
+			return nil, fmt.Errorf("data source %q: %w", d.Name, err)
+		}
+		if value != nil {
+			setPath(event, field.path(), value)
+		}
+	}
+	return event, nil
+}
+
+// path returns the keys the field is nested under in a decoded event
+func (f *Field) path() []string {
+	if f.FullName != "" {
+		return strings.Split(f.FullName, ".")
+	}
+	return []string{f.Name}
+}
+
+// decode reads the field's value from its payload. Values are in the byte
+// order of the node running the gadget, little endian on amd64 and arm64.
+func (f *Field) decode(payload []byte) (interface{}, error) {
+	data := payload
+	if f.Size > 0 {
+		end := int(f.Offs) + int(f.Size)
+		if end > len(payload) {
+			return nil, fmt.Errorf("field %q: offset %d+%d beyond payload of %d bytes", f.FullName, f.Offs, f.Size, len(payload))
+		}
+		data = payload[f.Offs:end]
+	}
+
+	switch f.Kind {
+	case KindString:
+		return string(data), nil
+	case KindCString:
+		if i := strings.IndexByte(string(data), 0); i >= 0 {
+			data = data[:i]
+		}
+		return string(data), nil
+	case KindBytes:
+		return append([]byte(nil), data...), nil
+	}
+
+	// Fixed size kinds
+	var size int
+	switch f.Kind {
+	case KindBool, KindInt8, KindUint8:
+		size = 1
+	case KindInt16, KindUint16:
+		size = 2
+	case KindInt32, KindUint32, KindFloat32:
+		size = 4
+	case KindInt64, KindUint64, KindFloat64:
+		size = 8
+	default:
+		// Unsupported kinds, e.g. arrays, are left out of the event
+		return nil, nil
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("field %q: %d bytes for a %d byte value", f.FullName, len(data), size)
+	}
+
+	switch f.Kind {
+	case KindBool:
+		return data[0] != 0, nil
+	case KindInt8:
+		return int64(int8(data[0])), nil
+	case KindUint8:
+		return uint64(data[0]), nil
+	case KindInt16:
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case KindUint16:
+		return uint64(binary.LittleEndian.Uint16(data)), nil
+	case KindInt32:
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case KindUint32:
+		return uint64(binary.LittleEndian.Uint32(data)), nil
+	case KindFloat32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	case KindInt64:
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case KindUint64:
+		return binary.LittleEndian.Uint64(data), nil
+	default: // KindFloat64
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	}
+}
+
+// setPath sets a value in nested maps, creating them as needed
+func setPath(event map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := event[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			event[key] = child
+		}
+		event = child
+	}
+	event[path[len(path)-1]] = value
+}
+
+func (d *DataSource) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 1:
+			d.ID = uint32(v)
+		case 2:
+			d.Name = string(raw)
+		case 3:
+			d.Type = uint32(v)
+		case 4:
+			var field Field
+			if err := field.unmarshal(raw); err != nil {
+				return err
+			}
+			d.Fields = append(d.Fields, field)
+		}
+		return nil
+	})
+}
+
+func (f *Field) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 1:
+			f.Name = string(raw)
+		case 2:
+			f.FullName = string(raw)
+		case 3:
+			f.Index = uint32(v)
+		case 4:
+			f.PayloadIndex = uint32(v)
+		case 5:
+			f.Offs = uint32(v)
+		case 6:
+			f.Size = uint32(v)
+		case 7:
+			f.Flags = uint32(v)
+		case 8:
+			f.Kind = uint32(v)
+		}
+		return nil
+	})
+}
+
+// unmarshalDataElement returns the payloads of a DataElement
+func unmarshalDataElement(b []byte) ([][]byte, error) {
+	var payloads [][]byte
+	err := consumeFields(b, func(num protowire.Number, v uint64, raw []byte) error {
+		if num == 1 {
+			payloads = append(payloads, raw)
+		}
+		return nil
+	})
+	return payloads, err
+}
+
+// consumeFields calls fn for each field of a message with its varint value,
+// or its contents for length-delimited fields. Other wire types are skipped.
+func consumeFields(b []byte, fn func(num protowire.Number, v uint64, raw []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var (
+			v   uint64
+			raw []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			raw, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, v, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
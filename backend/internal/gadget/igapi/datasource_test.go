@@ -0,0 +1,182 @@
+package igapi
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// fieldMessage builds a Field message
+func fieldMessage(t *testing.T, fullName string, payloadIndex, offs, size, flags, kind uint32) *dynamicpb.Message {
+	return newMessage(t, "Field", map[string]interface{}{
+		"name":         fullName[strings.LastIndex(fullName, ".")+1:],
+		"fullName":     fullName,
+		"payloadIndex": payloadIndex,
+		"offs":         offs,
+		"size":         size,
+		"flags":        flags,
+		"kind":         kind,
+	})
+}
+
+// tcpInfo is the GadgetInfo of a gadget whose events have a static payload
+// of fixed size fields and a variable size payload with the namespace
+func tcpInfo(t *testing.T, dataSourceType uint32) []byte {
+	return marshal(t, newMessage(t, "GadgetInfo", map[string]interface{}{
+		"name":      "trace_tcp",
+		"imageName": "ghcr.io/inspektor-gadget/gadget/trace_tcp:latest",
+		"dataSources": []*dynamicpb.Message{newMessage(t, "DataSource", map[string]interface{}{
+			"id":   uint32(7),
+			"name": "tcp",
+			"type": dataSourceType,
+			"fields": []*dynamicpb.Message{
+				fieldMessage(t, "src", 0, 0, 0, FieldFlagEmpty|FieldFlagContainer, KindInvalid),
+				fieldMessage(t, "src.port", 0, 0, 2, FieldFlagHasParent|FieldFlagStatic, KindUint16),
+				fieldMessage(t, "proc.pid", 0, 4, 4, FieldFlagStatic, KindUint32),
+				fieldMessage(t, "error", 0, 8, 4, FieldFlagStatic, KindInt32),
+				fieldMessage(t, "proc.comm", 0, 12, 16, FieldFlagStatic, KindCString),
+				fieldMessage(t, "latency", 0, 28, 8, FieldFlagStatic, KindFloat64),
+				fieldMessage(t, "mntns_id", 0, 36, 8, FieldFlagStatic|FieldFlagHidden, KindUint64),
+				fieldMessage(t, "k8s.namespace", 1, 0, 0, 0, KindString),
+			},
+		})},
+	}))
+}
+
+// tcpPayloads encodes the payloads of one event of tcpInfo
+func tcpPayloads(port uint16, pid uint32, errno int32, comm string, latency float64, namespace string) [][]byte {
+	static := make([]byte, 44)
+	binary.LittleEndian.PutUint16(static[0:], port)
+	binary.LittleEndian.PutUint32(static[4:], pid)
+	binary.LittleEndian.PutUint32(static[8:], uint32(errno))
+	copy(static[12:28], comm)
+	binary.LittleEndian.PutUint64(static[28:], math.Float64bits(latency))
+	binary.LittleEndian.PutUint64(static[36:], 4026531840)
+	return [][]byte{static, []byte(namespace)}
+}
+
+func TestUnmarshalGadgetInfo(t *testing.T) {
+	info, err := UnmarshalGadgetInfo(tcpInfo(t, DataSourceTypeSingle))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name != "trace_tcp" || info.ImageName != "ghcr.io/inspektor-gadget/gadget/trace_tcp:latest" {
+		t.Errorf("info = %q %q", info.Name, info.ImageName)
+	}
+	ds, ok := info.DataSource(7)
+	if !ok {
+		t.Fatalf("data source 7 missing from %+v", info.DataSources)
+	}
+	if ds.Name != "tcp" || ds.Type != DataSourceTypeSingle || len(ds.Fields) != 8 {
+		t.Fatalf("data source = %+v", ds)
+	}
+	want := Field{
+		Name:     "comm",
+		FullName: "proc.comm",
+		Offs:     12,
+		Size:     16,
+		Flags:    FieldFlagStatic,
+		Kind:     KindCString,
+	}
+	if !reflect.DeepEqual(ds.Fields[4], want) {
+		t.Errorf("field = %+v, want %+v", ds.Fields[4], want)
+	}
+	if _, ok := info.DataSource(8); ok {
+		t.Error("found unknown data source 8")
+	}
+}
+
+func TestDecodePayloadSingle(t *testing.T) {
+	info, err := UnmarshalGadgetInfo(tcpInfo(t, DataSourceTypeSingle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, _ := info.DataSource(7)
+
+	payload := marshal(t, newMessage(t, "GadgetData", map[string]interface{}{
+		"seq": uint32(1),
+		"data": newMessage(t, "DataElement", map[string]interface{}{
+			"payload": tcpPayloads(443, 1234, -111, "curl\x00garbage", 1.5, "fruits"),
+		}),
+	}))
+	events, err := ds.DecodePayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]interface{}{{
+		"src":     map[string]interface{}{"port": uint64(443)},
+		"proc":    map[string]interface{}{"pid": uint64(1234), "comm": "curl"},
+		"error":   int64(-111),
+		"latency": 1.5,
+		"k8s":     map[string]interface{}{"namespace": "fruits"},
+	}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events\n got: %v\nwant: %v", events, want)
+	}
+}
+
+func TestDecodePayloadArray(t *testing.T) {
+	info, err := UnmarshalGadgetInfo(tcpInfo(t, DataSourceTypeArray))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, _ := info.DataSource(7)
+
+	payload := marshal(t, newMessage(t, "GadgetDataArray", map[string]interface{}{
+		"dataArray": []*dynamicpb.Message{
+			newMessage(t, "DataElement", map[string]interface{}{
+				"payload": tcpPayloads(80, 1, 0, "nginx", 0, "fruits"),
+			}),
+			newMessage(t, "DataElement", map[string]interface{}{
+				"payload": tcpPayloads(5432, 2, 0, "postgres", 0, "db"),
+			}),
+		},
+	}))
+	events, err := ds.DecodePayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %v", len(events), events)
+	}
+	for i, want := range []struct {
+		comm      string
+		port      uint64
+		namespace string
+	}{{"nginx", 80, "fruits"}, {"postgres", 5432, "db"}} {
+		event := events[i]
+		if got := event["proc"].(map[string]interface{})["comm"]; got != want.comm {
+			t.Errorf("event %d comm = %v, want %s", i, got, want.comm)
+		}
+		if got := event["src"].(map[string]interface{})["port"]; got != want.port {
+			t.Errorf("event %d port = %v, want %d", i, got, want.port)
+		}
+		if got := event["k8s"].(map[string]interface{})["namespace"]; got != want.namespace {
+			t.Errorf("event %d namespace = %v, want %s", i, got, want.namespace)
+		}
+	}
+}
+
+func TestDecodePayloadShortPayload(t *testing.T) {
+	info, err := UnmarshalGadgetInfo(tcpInfo(t, DataSourceTypeSingle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, _ := info.DataSource(7)
+
+	payload := marshal(t, newMessage(t, "GadgetData", map[string]interface{}{
+		"data": newMessage(t, "DataElement", map[string]interface{}{
+			"payload": [][]byte{make([]byte, 10), []byte("fruits")},
+		}),
+	}))
+	if _, err := ds.DecodePayload(payload); err == nil {
+		t.Error("decoded fields beyond the end of the payload")
+	}
+}
@@ -0,0 +1,220 @@
+// Package igapi is a minimal client for the Inspektor Gadget gadget service
+// gRPC API (GadgetManager.RunGadget).
+//
+// Only the messages needed to run a gadget and decode its events are
+// implemented, encoded by hand with protowire so the backend doesn't depend
+// on the whole Inspektor Gadget module. Field numbers are transcribed from
+// the upstream pkg/gadget-service/api/api.proto rather than generated from
+// it, so check them against the proto when upgrading the gadget service.
+//
+// Event payloads are protobuf data source messages (GadgetData and
+// GadgetDataArray) laid out as described by the GadgetInfo the service
+// sends first; see DataSource.DecodePayload.
+package igapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// APIVersion is the gadget service API version sent with run requests
+const APIVersion = 1
+
+// Event types carried in GadgetEvent.Type. The upper 16 bits hold the log
+// severity for log events.
+const (
+	EventTypeGadgetPayload uint32 = 0
+	EventTypeGadgetResult  uint32 = 1
+	EventTypeGadgetDone    uint32 = 2
+	EventTypeGadgetJobID   uint32 = 3
+	EventTypeGadgetInfo    uint32 = 4
+
+	EventLogShift = 16
+)
+
+// Log severities, as encoded in the upper bits of GadgetEvent.Type.
+// Panic is never sent since a zero severity marks a non-log event.
+const (
+	LogLevelPanic uint32 = iota
+	LogLevelFatal
+	LogLevelError
+	LogLevelWarn
+	LogLevelInfo
+	LogLevelDebug
+	LogLevelTrace
+)
+
+const runGadgetMethod = "/api.GadgetManager/RunGadget"
+
+// GadgetRunRequest starts a gadget
+type GadgetRunRequest struct {
+	ImageName   string
+	ParamValues map[string]string
+	Args        []string
+	Timeout     int64 // nanoseconds, 0 runs until stopped
+	Version     uint32
+}
+
+// GadgetEvent is a message streamed back from a running gadget
+type GadgetEvent struct {
+	Type         uint32
+	Seq          uint32
+	Payload      []byte
+	DataSourceID uint32
+}
+
+// EventType returns the event type without the log severity bits
+func (e *GadgetEvent) EventType() uint32 {
+	return e.Type & (1<<EventLogShift - 1)
+}
+
+// LogLevel returns the log severity of a log event and whether it is one
+func (e *GadgetEvent) LogLevel() (uint32, bool) {
+	level := e.Type >> EventLogShift
+	return level, level != 0
+}
+
+// RunStream is an open RunGadget call
+type RunStream struct {
+	stream grpc.ClientStream
+}
+
+// RunGadget opens a RunGadget stream and sends the run request
+func RunGadget(ctx context.Context, conn *grpc.ClientConn, req GadgetRunRequest) (*RunStream, error) {
+	desc := &grpc.StreamDesc{
+		StreamName:    "RunGadget",
+		ServerStreams: true,
+		ClientStreams: true,
+	}
+
+	stream, err := conn.NewStream(ctx, desc, runGadgetMethod, grpc.ForceCodec(codec{}))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stream.SendMsg(&controlRequest{run: &req}); err != nil {
+		return nil, err
+	}
+
+	return &RunStream{stream: stream}, nil
+}
+
+// Recv receives the next event
+func (s *RunStream) Recv() (*GadgetEvent, error) {
+	event := &GadgetEvent{}
+	if err := s.stream.RecvMsg(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Stop asks the gadget service to stop the gadget. Remaining events,
+// including the final done event, can still be received.
+func (s *RunStream) Stop() error {
+	if err := s.stream.SendMsg(&controlRequest{stop: true}); err != nil {
+		return err
+	}
+	return s.stream.CloseSend()
+}
+
+// controlRequest is GadgetControlRequest, a oneof of run and stop requests
+type controlRequest struct {
+	run  *GadgetRunRequest
+	stop bool
+}
+
+func (r *controlRequest) marshal() []byte {
+	var b []byte
+	switch {
+	case r.run != nil:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.run.marshal())
+	case r.stop:
+		// GadgetStopRequest has no fields
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, nil)
+	}
+	return b
+}
+
+func (r *GadgetRunRequest) marshal() []byte {
+	var b []byte
+	if r.ImageName != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, r.ImageName)
+	}
+
+	// Map entries are messages with key = 1 and value = 2, sorted for
+	// deterministic output
+	keys := make([]string, 0, len(r.ParamValues))
+	for key := range r.ParamValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, r.ParamValues[key])
+
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	for _, arg := range r.Args {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, arg)
+	}
+	if r.Timeout != 0 {
+		b = protowire.AppendTag(b, 13, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Timeout))
+	}
+	if r.Version != 0 {
+		b = protowire.AppendTag(b, 14, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Version))
+	}
+	return b
+}
+
+func (e *GadgetEvent) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 1:
+			e.Type = uint32(v)
+		case 2:
+			e.Seq = uint32(v)
+		case 3:
+			e.Payload = append([]byte(nil), raw...)
+		case 4:
+			e.DataSourceID = uint32(v)
+		}
+		// Fields added by newer gadget service versions are skipped
+		return nil
+	})
+}
+
+// codec marshals the hand-written messages of this package
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	switch msg := v.(type) {
+	case *controlRequest:
+		return msg.marshal(), nil
+	}
+	return nil, fmt.Errorf("igapi: cannot marshal %T", v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	switch msg := v.(type) {
+	case *GadgetEvent:
+		return msg.unmarshal(data)
+	}
+	return fmt.Errorf("igapi: cannot unmarshal into %T", v)
+}
@@ -0,0 +1,335 @@
+package igapi
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// The messages of the gadget service API this package implements, as
+// declared in pkg/gadget-service/api/api.proto. The tests encode and decode
+// them with the protobuf library to check the hand-written codec.
+var apiFile = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("api.proto"),
+	Package: proto.String("api"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("GadgetRunRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("imageName", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				repeatedField("paramValues", 2, ".api.GadgetRunRequest.ParamValuesEntry"),
+				{
+					Name:   proto.String("args"),
+					Number: proto.Int32(3),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+					Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				scalarField("timeout", 13, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				scalarField("version", 14, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("ParamValuesEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					scalarField("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					scalarField("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		},
+		{Name: proto.String("GadgetStopRequest")},
+		{
+			Name: proto.String("GadgetControlRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				oneofField("runRequest", 1, ".api.GadgetRunRequest"),
+				oneofField("stopRequest", 2, ".api.GadgetStopRequest"),
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("Event")}},
+		},
+		{
+			Name: proto.String("GadgetEvent"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("type", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("seq", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("payload", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				scalarField("dataSourceID", 4, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+			},
+		},
+		{
+			Name: proto.String("GadgetInfo"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalarField("imageName", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				repeatedField("dataSources", 3, ".api.DataSource"),
+			},
+		},
+		{
+			Name: proto.String("DataSource"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalarField("type", 3, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				repeatedField("fields", 4, ".api.Field"),
+			},
+		},
+		{
+			Name: proto.String("Field"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalarField("fullName", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalarField("index", 3, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("payloadIndex", 4, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("offs", 5, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("size", 6, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				scalarField("flags", 7, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				{
+					Name:     proto.String("kind"),
+					Number:   proto.Int32(8),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(),
+					TypeName: proto.String(".api.Kind"),
+				},
+			},
+		},
+		{
+			Name: proto.String("DataElement"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("payload"),
+				Number: proto.Int32(1),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum(),
+			}},
+		},
+		{
+			Name: proto.String("GadgetData"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("seq", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				{
+					Name:     proto.String("data"),
+					Number:   proto.Int32(3),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".api.DataElement"),
+				},
+			},
+		},
+		{
+			Name: proto.String("GadgetDataArray"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				scalarField("seq", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				repeatedField("dataArray", 3, ".api.DataElement"),
+			},
+		},
+	},
+	EnumType: []*descriptorpb.EnumDescriptorProto{{
+		Name: proto.String("Kind"),
+		Value: []*descriptorpb.EnumValueDescriptorProto{
+			{Name: proto.String("Invalid"), Number: proto.Int32(int32(KindInvalid))},
+			{Name: proto.String("Bool"), Number: proto.Int32(int32(KindBool))},
+			{Name: proto.String("Int8"), Number: proto.Int32(int32(KindInt8))},
+			{Name: proto.String("Int16"), Number: proto.Int32(int32(KindInt16))},
+			{Name: proto.String("Int32"), Number: proto.Int32(int32(KindInt32))},
+			{Name: proto.String("Int64"), Number: proto.Int32(int32(KindInt64))},
+			{Name: proto.String("Uint8"), Number: proto.Int32(int32(KindUint8))},
+			{Name: proto.String("Uint16"), Number: proto.Int32(int32(KindUint16))},
+			{Name: proto.String("Uint32"), Number: proto.Int32(int32(KindUint32))},
+			{Name: proto.String("Uint64"), Number: proto.Int32(int32(KindUint64))},
+			{Name: proto.String("Float32"), Number: proto.Int32(int32(KindFloat32))},
+			{Name: proto.String("Float64"), Number: proto.Int32(int32(KindFloat64))},
+			{Name: proto.String("String"), Number: proto.Int32(int32(KindString))},
+			{Name: proto.String("CString"), Number: proto.Int32(int32(KindCString))},
+			{Name: proto.String("Bytes"), Number: proto.Int32(int32(KindBytes))},
+		},
+	}},
+}
+
+func scalarField(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   typ.Enum(),
+	}
+}
+
+func repeatedField(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+		TypeName: proto.String(typeName),
+	}
+}
+
+func oneofField(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	field := repeatedField(name, number, typeName)
+	field.Label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	field.OneofIndex = proto.Int32(0)
+	return field
+}
+
+// messageType returns the descriptor of an API message
+func messageType(t *testing.T, name string) protoreflect.MessageDescriptor {
+	t.Helper()
+	file, err := protodesc.NewFile(apiFile, nil)
+	if err != nil {
+		t.Fatalf("invalid API descriptor: %v", err)
+	}
+	md := file.Messages().ByName(protoreflect.Name(name))
+	if md == nil {
+		t.Fatalf("no message %s", name)
+	}
+	return md
+}
+
+// newMessage builds an API message. Values are Go values of the field's
+// kind; repeated fields take slices.
+func newMessage(t *testing.T, name string, values map[string]interface{}) *dynamicpb.Message {
+	t.Helper()
+	md := messageType(t, name)
+	m := dynamicpb.NewMessage(md)
+	for key, value := range values {
+		fd := md.Fields().ByName(protoreflect.Name(key))
+		if fd == nil {
+			t.Fatalf("%s has no field %s", name, key)
+		}
+		switch v := value.(type) {
+		case []*dynamicpb.Message:
+			list := m.Mutable(fd).List()
+			for _, item := range v {
+				list.Append(protoreflect.ValueOfMessage(item))
+			}
+		case [][]byte:
+			list := m.Mutable(fd).List()
+			for _, item := range v {
+				list.Append(protoreflect.ValueOfBytes(item))
+			}
+		case *dynamicpb.Message:
+			m.Set(fd, protoreflect.ValueOfMessage(v))
+		default:
+			if fd.Kind() == protoreflect.EnumKind {
+				m.Set(fd, protoreflect.ValueOfEnum(protoreflect.EnumNumber(v.(uint32))))
+				continue
+			}
+			m.Set(fd, protoreflect.ValueOf(value))
+		}
+	}
+	return m
+}
+
+// marshal encodes a message with the protobuf library
+func marshal(t *testing.T, m *dynamicpb.Message) []byte {
+	t.Helper()
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGadgetRunRequestMarshal(t *testing.T) {
+	req := GadgetRunRequest{
+		ImageName: "trace_tcp:latest",
+		ParamValues: map[string]string{
+			"operator.KubeManager.namespace": "fruits",
+			"operator.oci.ebpf.connect-only": "true",
+		},
+		Args:    []string{"--verbose"},
+		Timeout: 5_000_000_000,
+		Version: APIVersion,
+	}
+	data, err := codec{}.Marshal(&controlRequest{run: &req})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	control := dynamicpb.NewMessage(messageType(t, "GadgetControlRequest"))
+	if err := proto.Unmarshal(data, control); err != nil {
+		t.Fatalf("not a GadgetControlRequest: %v", err)
+	}
+	runField := control.Descriptor().Fields().ByName("runRequest")
+	if !control.Has(runField) {
+		t.Fatal("runRequest not set")
+	}
+	run := control.Get(runField).Message()
+	fields := run.Descriptor().Fields()
+
+	if got := run.Get(fields.ByName("imageName")).String(); got != req.ImageName {
+		t.Errorf("imageName = %q, want %q", got, req.ImageName)
+	}
+	params := map[string]string{}
+	run.Get(fields.ByName("paramValues")).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		params[k.String()] = v.String()
+		return true
+	})
+	if !reflect.DeepEqual(params, req.ParamValues) {
+		t.Errorf("paramValues = %v, want %v", params, req.ParamValues)
+	}
+	args := run.Get(fields.ByName("args")).List()
+	if args.Len() != 1 || args.Get(0).String() != "--verbose" {
+		t.Errorf("args = %v, want [--verbose]", args)
+	}
+	if got := run.Get(fields.ByName("timeout")).Int(); got != req.Timeout {
+		t.Errorf("timeout = %d, want %d", got, req.Timeout)
+	}
+	if got := run.Get(fields.ByName("version")).Uint(); got != APIVersion {
+		t.Errorf("version = %d, want %d", got, APIVersion)
+	}
+	if len(run.GetUnknown()) > 0 || len(control.GetUnknown()) > 0 {
+		t.Errorf("unknown fields in run request: %x", data)
+	}
+}
+
+func TestGadgetStopRequestMarshal(t *testing.T) {
+	data, err := codec{}.Marshal(&controlRequest{stop: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	control := dynamicpb.NewMessage(messageType(t, "GadgetControlRequest"))
+	if err := proto.Unmarshal(data, control); err != nil {
+		t.Fatalf("not a GadgetControlRequest: %v", err)
+	}
+	oneof := control.Descriptor().Oneofs().ByName("Event")
+	if which := control.WhichOneof(oneof); which == nil || which.Name() != "stopRequest" {
+		t.Errorf("control request is %v, want stopRequest", which)
+	}
+}
+
+func TestGadgetEventUnmarshal(t *testing.T) {
+	message := newMessage(t, "GadgetEvent", map[string]interface{}{
+		"type":         EventTypeGadgetPayload | LogLevelWarn<<EventLogShift,
+		"seq":          uint32(42),
+		"payload":      []byte("payload"),
+		"dataSourceID": uint32(3),
+	})
+	// A field added by a newer gadget service
+	message.SetUnknown(protoreflect.RawFields{0xa8, 0x06, 0x01}) // field 101, varint 1
+
+	var event GadgetEvent
+	if err := (codec{}).Unmarshal(marshal(t, message), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	want := GadgetEvent{
+		Type:         LogLevelWarn << EventLogShift,
+		Seq:          42,
+		Payload:      []byte("payload"),
+		DataSourceID: 3,
+	}
+	if !reflect.DeepEqual(event, want) {
+		t.Errorf("event = %+v, want %+v", event, want)
+	}
+	if level, ok := event.LogLevel(); !ok || level != LogLevelWarn {
+		t.Errorf("LogLevel() = %d, %v, want %d, true", level, ok, LogLevelWarn)
+	}
+	if got := event.EventType(); got != EventTypeGadgetPayload {
+		t.Errorf("EventType() = %d, want %d", got, EventTypeGadgetPayload)
+	}
+}
@@ -0,0 +1,119 @@
+package gadget
+
+import "fmt"
+
+// OverflowPolicy decides what happens to events when a session's buffers are
+// full: the gadget output channel and each WebSocket client's send buffer
+type OverflowPolicy string
+
+const (
+	// OverflowDrop drops new events while the buffer is full (the default)
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowBlock waits for room in the gadget output buffer, applying
+	// backpressure to the gadget. WebSocket clients are never waited for:
+	// one whose send buffer is full is disconnected.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest discards the oldest buffered event to make room
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowSample keeps 1 in SampleRate events once the buffer fills,
+	// until it has drained to half its capacity
+	OverflowSample OverflowPolicy = "sample"
+)
+
+// DefaultSampleRate is the N in 1-in-N sampling when none is requested
+const DefaultSampleRate = 10
+
+// Delivery is the outcome of delivering an event to a buffer
+type Delivery int
+
+const (
+	// Delivered means the event was buffered
+	Delivered Delivery = iota
+	// Dropped means an event was lost because the buffer was full. With
+	// OverflowDropOldest the lost event is the oldest buffered one.
+	Dropped
+	// Sampled means the event was skipped by sampling
+	Sampled
+)
+
+// Overflow applies an overflow policy to one buffer. It keeps sampling state
+// and must only be used by the buffer's single producer.
+type Overflow struct {
+	Policy     OverflowPolicy
+	SampleRate int
+
+	sampling bool
+	skipped  int
+}
+
+// NewOverflow creates the overflow state for a buffer
+func NewOverflow(policy OverflowPolicy, sampleRate int) *Overflow {
+	if policy == "" {
+		policy = OverflowDrop
+	}
+	if sampleRate == 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &Overflow{Policy: policy, SampleRate: sampleRate}
+}
+
+// ValidateOverflow checks the overflow settings of a request
+func ValidateOverflow(policy OverflowPolicy, sampleRate int) error {
+	switch policy {
+	case "", OverflowDrop, OverflowBlock, OverflowDropOldest, OverflowSample:
+	default:
+		return &ValidationError{Field: "overflowPolicy", Message: fmt.Sprintf("unknown policy %q", policy)}
+	}
+	if sampleRate != 0 && sampleRate < 2 {
+		return &ValidationError{Field: "sampleRate", Message: "must be at least 2"}
+	}
+	return nil
+}
+
+// Deliver sends v on ch according to the overflow policy. With OverflowBlock
+// it waits until there is room or done is closed; a nil done waits forever.
+func Deliver[T any](o *Overflow, ch chan T, v T, done <-chan struct{}) Delivery {
+	switch o.Policy {
+	case OverflowBlock:
+		select {
+		case ch <- v:
+			return Delivered
+		case <-done:
+			return Dropped
+		}
+	case OverflowSample:
+		if o.sampling {
+			if len(ch) <= cap(ch)/2 {
+				// Backlog cleared
+				o.sampling = false
+			} else {
+				o.skipped++
+				if o.skipped%o.SampleRate != 0 {
+					return Sampled
+				}
+			}
+		}
+	}
+
+	select {
+	case ch <- v:
+		return Delivered
+	default:
+	}
+
+	switch o.Policy {
+	case OverflowDropOldest:
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- v:
+		default:
+		}
+	case OverflowSample:
+		o.sampling = true
+		o.skipped = 0
+	}
+	return Dropped
+}
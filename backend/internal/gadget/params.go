@@ -0,0 +1,131 @@
+package gadget
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// ValidationError reports an invalid field in a gadget request
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// ResolveParams validates the params of a request against the gadget's
+// parameter schema and returns them normalized, with defaults applied.
+// Bool values are returned as bool, strings as string and ints as int64.
+func (d *Definition) ResolveParams(req models.GadgetRequest) (map[string]interface{}, error) {
+	specs := make(map[string]*ParamSpec, len(d.Params))
+	for i := range d.Params {
+		specs[d.Params[i].Name] = &d.Params[i]
+	}
+
+	for name := range req.Params {
+		if _, ok := specs[name]; !ok {
+			return nil, &ValidationError{
+				Field:   "params." + name,
+				Message: fmt.Sprintf("unknown parameter for gadget %s", d.Type),
+			}
+		}
+	}
+
+	resolved := make(map[string]interface{}, len(d.Params))
+	for _, spec := range d.Params {
+		value, ok := req.Params[spec.Name]
+		if !ok || value == nil {
+			// The TCP specific fields predate Params and are still accepted
+			if legacyFlag(req, spec.Name) {
+				resolved[spec.Name] = true
+			} else if spec.Default != nil {
+				resolved[spec.Name] = spec.Default
+			}
+			continue
+		}
+
+		normalized, err := spec.validate(value)
+		if err != nil {
+			return nil, &ValidationError{Field: "params." + spec.Name, Message: err.Error()}
+		}
+		resolved[spec.Name] = normalized
+	}
+
+	return resolved, nil
+}
+
+// validate checks a single param value and converts it to its Go type
+func (p *ParamSpec) validate(value interface{}) (interface{}, error) {
+	switch p.Type {
+	case "bool":
+		v, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a boolean, got %T", value)
+		}
+		return v, nil
+
+	case "string":
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %T", value)
+		}
+		if len(p.Allowed) > 0 && !contains(p.Allowed, v) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(p.Allowed, ", "))
+		}
+		// Filter expressions are comma separated
+		if p.Filter != "" && strings.Contains(v, ",") {
+			return nil, fmt.Errorf("must not contain ','")
+		}
+		return v, nil
+
+	case "int":
+		// JSON numbers decode as float64
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("expected an integer, got %v", value)
+		}
+		v := int64(f)
+		if p.Min != nil && v < *p.Min {
+			return nil, fmt.Errorf("must be at least %d", *p.Min)
+		}
+		if p.Max != nil && v > *p.Max {
+			return nil, fmt.Errorf("must be at most %d", *p.Max)
+		}
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("unsupported parameter type %q", p.Type)
+}
+
+// legacyFlag returns the value of one of the TCP specific request fields
+func legacyFlag(req models.GadgetRequest, name string) bool {
+	switch name {
+	case "acceptOnly":
+		return req.AcceptOnly
+	case "connectOnly":
+		return req.ConnectOnly
+	case "failureOnly":
+		return req.FailureOnly
+	}
+	return false
+}
+
+// contains reports whether values contains v
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// intPtr returns a pointer to v, for ParamSpec bounds
+func intPtr(v int64) *int64 {
+	return &v
+}
@@ -0,0 +1,185 @@
+package gadget
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// OutputMode describes the shape of a gadget's JSON output
+type OutputMode string
+
+const (
+	// OutputStreaming gadgets emit one JSON object per event until stopped
+	OutputStreaming OutputMode = "streaming"
+	// OutputSnapshot gadgets emit a single JSON array and exit
+	OutputSnapshot OutputMode = "snapshot"
+	// OutputInterval gadgets emit a fresh JSON array (a frame) every interval
+	OutputInterval OutputMode = "interval"
+)
+
+// ParamSpec describes a parameter a gadget accepts
+type ParamSpec struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // "bool", "string" or "int"
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Allowed     []string    `json:"allowed,omitempty"` // allowed values for string params
+	Min         *int64      `json:"min,omitempty"`     // bounds for int params
+	Max         *int64      `json:"max,omitempty"`
+	Flag        string      `json:"-"` // kubectl-gadget flag, e.g. "--accept-only"
+	// Unit is appended to int values passed to Flag, e.g. "s" for
+	// duration flags
+	Unit string `json:"-"`
+	// ServiceParam is the gadget service parameter Flag corresponds to,
+	// when it isn't one of the gadget's own, see grpcParamKey
+	ServiceParam string `json:"-"`
+	// Filter is a gadget --filter expression used instead of Flag.
+	// String params substitute their value for %s, e.g. "qtype==%s".
+	Filter string `json:"-"`
+}
+
+// flagValue formats an int param value for its flag
+func (p *ParamSpec) flagValue(v int64) string {
+	return strconv.FormatInt(v, 10) + p.Unit
+}
+
+// Definition describes a gadget the backend knows how to run
+type Definition struct {
+	Type        models.GadgetType `json:"type"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Category    string            `json:"category"` // "trace", "snapshot", ...
+	Image       string            `json:"image"`
+	OutputMode  OutputMode        `json:"outputMode"`
+	// Whether the gadget can be narrowed down to a namespace / pod
+	SupportsNamespace bool        `json:"supportsNamespace"`
+	SupportsPodName   bool        `json:"supportsPodName"`
+	Params            []ParamSpec `json:"params,omitempty"`
+}
+
+// BuildArgs builds the kubectl-gadget arguments for a request.
+// params must have been validated with ResolveParams.
+func (d *Definition) BuildArgs(req models.GadgetRequest, params map[string]interface{}) []string {
+	args := []string{"run", d.Image}
+
+	if d.SupportsNamespace {
+		if req.Namespace != "" {
+			args = append(args, "-n", req.Namespace)
+		} else {
+			// When no namespace is specified, trace all namespaces
+			args = append(args, "-A")
+		}
+	}
+	if d.SupportsPodName && req.PodName != "" {
+		args = append(args, "--podname", req.PodName)
+	}
+
+	var filters []string
+	for _, param := range d.Params {
+		value, ok := params[param.Name]
+		if !ok {
+			continue
+		}
+
+		switch v := value.(type) {
+		case bool:
+			if !v {
+				continue
+			}
+			if param.Filter != "" {
+				filters = append(filters, param.Filter)
+			} else {
+				args = append(args, param.Flag)
+			}
+		case string:
+			if v == "" {
+				continue
+			}
+			if param.Filter != "" {
+				filters = append(filters, fmt.Sprintf(param.Filter, v))
+			} else {
+				args = append(args, param.Flag, v)
+			}
+		case int64:
+			args = append(args, param.Flag, param.flagValue(v))
+		}
+	}
+	if len(filters) > 0 {
+		args = append(args, "--filter", strings.Join(filters, ","))
+	}
+
+	return append(args, "-o", "json")
+}
+
+// Registry holds the set of gadgets available to the backend
+type Registry struct {
+	mu      sync.RWMutex
+	gadgets map[models.GadgetType]*Definition
+	order   []models.GadgetType
+}
+
+// NewRegistry creates an empty gadget registry
+func NewRegistry() *Registry {
+	return &Registry{
+		gadgets: make(map[models.GadgetType]*Definition),
+	}
+}
+
+// DefaultRegistry creates a registry containing all built-in gadgets
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, def := range builtinGadgets {
+		if err := r.Register(def); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds a gadget definition to the registry
+func (r *Registry) Register(def Definition) error {
+	if def.Type == "" {
+		return fmt.Errorf("gadget type is required")
+	}
+	if def.Image == "" {
+		return fmt.Errorf("gadget %s: image is required", def.Type)
+	}
+	if def.OutputMode == "" {
+		def.OutputMode = OutputStreaming
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.gadgets[def.Type]; exists {
+		return fmt.Errorf("gadget already registered: %s", def.Type)
+	}
+	r.gadgets[def.Type] = &def
+	r.order = append(r.order, def.Type)
+
+	return nil
+}
+
+// Lookup retrieves a gadget definition by type
+func (r *Registry) Lookup(gadgetType models.GadgetType) (*Definition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	def, exists := r.gadgets[gadgetType]
+	return def, exists
+}
+
+// List returns all registered gadgets in registration order
+func (r *Registry) List() []Definition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]Definition, 0, len(r.order))
+	for _, gadgetType := range r.order {
+		defs = append(defs, *r.gadgets[gadgetType])
+	}
+	return defs
+}
@@ -0,0 +1,102 @@
+package gadget
+
+import (
+	"reflect"
+	"testing"
+
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// resolve validates a request against a builtin gadget's parameters
+func resolve(t *testing.T, req models.GadgetRequest) (*Definition, map[string]interface{}) {
+	t.Helper()
+	def, ok := DefaultRegistry().Lookup(req.Type)
+	if !ok {
+		t.Fatalf("gadget %s not registered", req.Type)
+	}
+	params, err := def.ResolveParams(req)
+	if err != nil {
+		t.Fatalf("ResolveParams: %v", err)
+	}
+	return def, params
+}
+
+func TestBuildArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		req  models.GadgetRequest
+		want []string
+	}{
+		{
+			name: "top defaults",
+			req:  models.GadgetRequest{Type: models.GadgetTopTCP},
+			want: []string{"run", "top_tcp:latest", "-A", "--map-fetch-interval", "1s", "--max-entries", "20", "-o", "json"},
+		},
+		{
+			name: "top params",
+			req: models.GadgetRequest{Type: models.GadgetTopFile, Namespace: "fruits",
+				Params: map[string]interface{}{"interval": 5.0, "maxRows": 50.0}},
+			want: []string{"run", "top_file:latest", "-n", "fruits", "--map-fetch-interval", "5s", "--max-entries", "50", "-o", "json"},
+		},
+		{
+			name: "flags and legacy fields",
+			req:  models.GadgetRequest{Type: models.GadgetTraceTCP, PodName: "apple", ConnectOnly: true},
+			want: []string{"run", "trace_tcp:latest", "-A", "--podname", "apple", "--connect-only", "-o", "json"},
+		},
+		{
+			name: "filters",
+			req: models.GadgetRequest{Type: models.GadgetTraceDNS, Namespace: "fruits",
+				Params: map[string]interface{}{"qtype": "AAAA", "name": "^svc"}},
+			want: []string{"run", "trace_dns:latest", "-n", "fruits", "--filter", "qtype==AAAA,name~^svc", "-o", "json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, params := resolve(t, tt.req)
+			if got := def.BuildArgs(tt.req, params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildArgs\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCParamValues(t *testing.T) {
+	tests := []struct {
+		name string
+		req  models.GadgetRequest
+		want map[string]string
+	}{
+		{
+			name: "top params",
+			req: models.GadgetRequest{Type: models.GadgetTopBlockIO, Namespace: "fruits",
+				Params: map[string]interface{}{"interval": 10.0}},
+			want: map[string]string{
+				"operator.KubeManager.namespace":       "fruits",
+				"operator.oci.ebpf.map-fetch-interval": "10s",
+				"operator.limiter.max-entries":         "20",
+			},
+		},
+		{
+			name: "flags and filters",
+			req: models.GadgetRequest{Type: models.GadgetTraceExec, PodName: "apple",
+				Params: map[string]interface{}{"paths": true, "comm": "sh"}},
+			want: map[string]string{
+				"operator.KubeManager.all-namespaces": "true",
+				"operator.KubeManager.podname":        "apple",
+				"operator.oci.ebpf.paths":             "true",
+				"operator.filter.filter":              "comm==sh",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, params := resolve(t, tt.req)
+			got := grpcParamValues(RunSpec{Request: tt.req, Definition: def, Params: params})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("grpcParamValues\n got: %v\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
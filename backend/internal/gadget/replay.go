@@ -0,0 +1,252 @@
+package gadget
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultReplayInterval paces recorded events that carry no timestamp
+const DefaultReplayInterval = 100 * time.Millisecond
+
+// ReplayRunner is a Runner that replays recorded gadget output instead of
+// running kubectl-gadget, so the backend can run without a cluster.
+//
+// Recordings live in Dir as <gadget type>.jsonl, one JSON object per line.
+// A line is either a GadgetOutput as returned by the events API
+// ({"timestamp": ..., "data": {...}, "frame": ...}) or a raw gadget event.
+// GadgetOutput lines are paced by the gaps between their timestamps,
+// raw events by DefaultReplayInterval.
+type ReplayRunner struct {
+	Dir string
+	// Speed multiplies the replay rate: 2 replays twice as fast as recorded,
+	// 0 replays without any delay
+	Speed float64
+	// Loop restarts the recording from the beginning until the session stops
+	Loop bool
+	// LoopPause is the delay before the recording restarts. It is not scaled
+	// by Speed, so looping without delays still yields between iterations.
+	// Zero uses DefaultReplayInterval.
+	LoopPause time.Duration
+}
+
+// replayRecord is one event read from a recording
+type replayRecord struct {
+	timestamp time.Time
+	frame     int64
+	data      json.RawMessage
+}
+
+// Start replays the recording for the spec's gadget type
+func (r *ReplayRunner) Start(ctx context.Context, spec RunSpec) (Process, error) {
+	path := filepath.Join(r.Dir, string(spec.Definition.Type)+".jsonl")
+	records, err := readRecording(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start gadget: %w", err)
+	}
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	process := &replayProcess{
+		stdout: stdoutReader,
+		done:   make(chan error, 1),
+	}
+
+	go func() {
+		err := r.replay(ctx, spec.Definition.OutputMode, records, stdoutWriter)
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			// Stopped or timed out, which ends the output like a gadget
+			// exiting does
+			err = nil
+		}
+		stdoutWriter.CloseWithError(err)
+		process.done <- err
+	}()
+
+	fmt.Printf("Started gadget replay: %s (%d events, speed %v)\n", path, len(records), r.Speed)
+
+	return process, nil
+}
+
+// replay writes the records to w in the shape of the gadget's output mode
+func (r *ReplayRunner) replay(ctx context.Context, mode OutputMode, records []replayRecord, w io.Writer) error {
+	for {
+		var err error
+		switch mode {
+		case OutputSnapshot:
+			err = r.replaySnapshot(records, w)
+		case OutputInterval:
+			err = r.replayFrames(ctx, records, w)
+		default:
+			err = r.replayStream(ctx, records, w)
+		}
+		if err != nil || !r.Loop || mode == OutputSnapshot {
+			return err
+		}
+
+		// The gap between the last and the first event isn't recorded
+		pause := r.LoopPause
+		if pause <= 0 {
+			pause = DefaultReplayInterval
+		}
+		if err := r.sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
+}
+
+// replayStream writes one JSON object per line
+func (r *ReplayRunner) replayStream(ctx context.Context, records []replayRecord, w io.Writer) error {
+	for i, record := range records {
+		if i > 0 {
+			if err := r.wait(ctx, records[i-1].timestamp, record.timestamp); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", record.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaySnapshot writes all records as a single JSON array
+func (r *ReplayRunner) replaySnapshot(records []replayRecord, w io.Writer) error {
+	items := make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		items = append(items, record.data)
+	}
+	return json.NewEncoder(w).Encode(items)
+}
+
+// replayFrames writes one JSON array per frame. Records without a frame
+// number are treated as single-row frames.
+func (r *ReplayRunner) replayFrames(ctx context.Context, records []replayRecord, w io.Writer) error {
+	var (
+		rows      []json.RawMessage
+		lastFrame int64
+		lastTime  time.Time
+	)
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		err := json.NewEncoder(w).Encode(rows)
+		rows = nil
+		return err
+	}
+
+	for _, record := range records {
+		if len(rows) > 0 && (record.frame == 0 || record.frame != lastFrame) {
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := r.wait(ctx, lastTime, record.timestamp); err != nil {
+				return err
+			}
+		}
+		rows = append(rows, record.data)
+		lastFrame = record.frame
+		lastTime = record.timestamp
+	}
+
+	return flush()
+}
+
+// wait sleeps for the gap between two recorded events, scaled by Speed
+func (r *ReplayRunner) wait(ctx context.Context, prev, next time.Time) error {
+	if r.Speed <= 0 {
+		return ctx.Err()
+	}
+
+	delay := DefaultReplayInterval
+	if !prev.IsZero() && !next.IsZero() {
+		delay = next.Sub(prev)
+	}
+	return r.sleep(ctx, time.Duration(float64(delay)/r.Speed))
+}
+
+// sleep waits for delay, or until ctx is done
+func (r *ReplayRunner) sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readRecording loads a JSONL recording
+func readRecording(path string) ([]replayRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+
+	var records []replayRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var recorded struct {
+			Timestamp time.Time       `json:"timestamp"`
+			Frame     int64           `json:"frame"`
+			Data      json.RawMessage `json:"data"`
+		}
+		// Raw gadget events have no "data" field, or one that is not an
+		// object, and may carry a timestamp that isn't RFC 3339
+		if err := json.Unmarshal([]byte(line), &recorded); err != nil || !isJSONObject(recorded.Data) {
+			if !json.Valid([]byte(line)) {
+				return nil, fmt.Errorf("%s:%d: invalid JSON", path, lineNo)
+			}
+			records = append(records, replayRecord{data: json.RawMessage(line)})
+			continue
+		}
+
+		records = append(records, replayRecord{
+			timestamp: recorded.Timestamp,
+			frame:     recorded.Frame,
+			data:      recorded.Data,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	return records, nil
+}
+
+// isJSONObject reports whether raw holds a JSON object
+func isJSONObject(raw json.RawMessage) bool {
+	trimmed := strings.TrimSpace(string(raw))
+	return strings.HasPrefix(trimmed, "{")
+}
+
+// replayProcess is the Process returned by ReplayRunner
+type replayProcess struct {
+	stdout io.Reader
+	done   chan error
+}
+
+func (p *replayProcess) Stdout() io.Reader { return p.stdout }
+func (p *replayProcess) Stderr() io.Reader { return strings.NewReader("") }
+func (p *replayProcess) Wait() error       { return <-p.done }
@@ -0,0 +1,78 @@
+package gadget
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// RunSpec describes a gadget run handed to a Runner
+type RunSpec struct {
+	Definition *Definition
+	Request    models.GadgetRequest
+	Params     map[string]interface{} // validated with ResolveParams
+	Args       []string               // kubectl-gadget arguments built from the above
+}
+
+// Runner starts gadget processes
+type Runner interface {
+	Start(ctx context.Context, spec RunSpec) (Process, error)
+}
+
+// Process is a running gadget. Stdout carries the gadget's JSON output in
+// the shape of its output mode; Stderr carries human readable errors.
+// Wait must only be called once both streams have been read to EOF.
+type Process interface {
+	Stdout() io.Reader
+	Stderr() io.Reader
+	Wait() error
+}
+
+// KubectlRunner runs gadgets by spawning kubectl-gadget
+type KubectlRunner struct {
+	// Binary is the kubectl-gadget executable, "kubectl-gadget" if empty
+	Binary string
+}
+
+// Start spawns kubectl-gadget with the spec's arguments
+func (r *KubectlRunner) Start(ctx context.Context, spec RunSpec) (Process, error) {
+	binary := r.Binary
+	if binary == "" {
+		binary = "kubectl-gadget"
+	}
+
+	cmd := exec.CommandContext(ctx, binary, spec.Args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start gadget: %w", err)
+	}
+
+	// Log command start
+	fmt.Printf("Started gadget: %s %v\n", binary, spec.Args)
+
+	return &cmdProcess{cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+// cmdProcess is a Process backed by an os/exec command
+type cmdProcess struct {
+	cmd    *exec.Cmd
+	stdout io.Reader
+	stderr io.Reader
+}
+
+func (p *cmdProcess) Stdout() io.Reader { return p.stdout }
+func (p *cmdProcess) Stderr() io.Reader { return p.stderr }
+func (p *cmdProcess) Wait() error       { return p.cmd.Wait() }
@@ -0,0 +1,142 @@
+package gadget
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultTimeout is used when a request does not specify a timeout
+	DefaultTimeout = 30 * time.Minute
+	// DefaultMaxTimeout is the default upper bound for session timeouts
+	DefaultMaxTimeout = 4 * time.Hour
+)
+
+// SetMaxTimeout sets the upper bound for per-session timeouts and extensions
+func (c *Client) SetMaxTimeout(maxTimeout time.Duration) {
+	c.maxTimeout = maxTimeout
+}
+
+// resolveTimeout converts a requested timeout into a session timeout
+func (c *Client) resolveTimeout(seconds int) (time.Duration, error) {
+	if seconds < 0 {
+		return 0, &ValidationError{Field: "timeoutSeconds", Message: "must not be negative"}
+	}
+	if seconds == 0 {
+		if DefaultTimeout > c.maxTimeout {
+			return c.maxTimeout, nil
+		}
+		return DefaultTimeout, nil
+	}
+
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > c.maxTimeout {
+		return 0, &ValidationError{
+			Field:   "timeoutSeconds",
+			Message: fmt.Sprintf("must be at most %d", int(c.maxTimeout.Seconds())),
+		}
+	}
+	return timeout, nil
+}
+
+// watchTimeout stops the session once its deadline passes. The deadline can
+// be moved by ExtendSession or SetPinned, which wake the watcher via resetCh.
+func (c *Client) watchTimeout(ctx context.Context, session *Session) {
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	for {
+		session.mu.Lock()
+		pinned := session.pinned
+		remaining := time.Until(session.deadline)
+		session.mu.Unlock()
+
+		// Pinned sessions only wait for a change or cancellation
+		var timeoutCh <-chan time.Time
+		if !pinned {
+			timer.Reset(remaining)
+			timeoutCh = timer.C
+		}
+
+		select {
+		case <-timeoutCh:
+			// Timeout reached, stop the gadget
+			fmt.Printf("Gadget session %s timed out after %v, stopping...\n", session.ID, time.Since(session.StartTime).Round(time.Second))
+			c.StopGadget(session.ID)
+			// Notify cleanup handler
+			if c.sessionEndedFunc != nil {
+				c.sessionEndedFunc(session.ID, "timeout")
+			}
+			return
+		case <-session.resetCh:
+			if !pinned && !timer.Stop() {
+				<-timer.C
+			}
+		case <-ctx.Done():
+			// Context cancelled before timeout
+			return
+		}
+	}
+}
+
+// ExtendSession moves a session's deadline further out, bounded by the
+// maximum timeout counted from now
+func (c *Client) ExtendSession(sessionID string, extension time.Duration) (*Session, error) {
+	if extension <= 0 {
+		return nil, &ValidationError{Field: "seconds", Message: "must be positive"}
+	}
+
+	session, exists := c.GetSession(sessionID)
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.mu.Lock()
+	deadline := session.deadline.Add(extension)
+	if limit := time.Now().Add(c.maxTimeout); deadline.After(limit) {
+		deadline = limit
+	}
+	session.deadline = deadline
+	session.Timeout = deadline.Sub(session.StartTime)
+	session.mu.Unlock()
+
+	session.notifyDeadlineChanged()
+	return session, nil
+}
+
+// SetPinned pins or unpins a session. Unpinning restarts the deadline from
+// now with the session's original timeout, bounded by the maximum timeout.
+func (c *Client) SetPinned(sessionID string, pinned bool) (*Session, error) {
+	session, exists := c.GetSession(sessionID)
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.mu.Lock()
+	if session.pinned && !pinned {
+		timeout := session.Timeout
+		if timeout > c.maxTimeout {
+			timeout = c.maxTimeout
+		}
+		session.deadline = time.Now().Add(timeout)
+		session.Timeout = session.deadline.Sub(session.StartTime)
+	}
+	session.pinned = pinned
+	session.mu.Unlock()
+
+	session.notifyDeadlineChanged()
+	return session, nil
+}
+
+// notifyDeadlineChanged wakes the timeout watcher without blocking
+func (s *Session) notifyDeadlineChanged() {
+	select {
+	case s.resetCh <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
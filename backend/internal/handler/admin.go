@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ListDeadLetters lists events the consumer could not store
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	letters, err := h.storage.ListDeadLetters(r.Context(), limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list dead letters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
+
+// ReplayDeadLetters sends dead-lettered events through the consumer again.
+// The body may list the dead letters to replay as {"ids": [...]}; without
+// it all of them are replayed.
+func (h *Handler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	replayed, err := h.storage.ReplayDeadLetters(r.Context(), req.IDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to replay dead letters after %d: %v", replayed, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"replayed": replayed})
+}
+
+// GetStreamStats reports the event stream's length and how far the consumer
+// group is behind it
+func (h *Handler) GetStreamStats(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	stats, err := h.storage.GetStreamStats(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get stream stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"inspector-gadget-management/backend/internal/gadget"
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// statsInterval is how often subscribers are sent the session's counters
+const statsInterval = 5 * time.Second
+
+// remoteViewersCheckInterval is how often a broadcaster checks whether other
+// backend instances relay its session. A viewer that connects to another
+// instance may miss up to this much output.
+const remoteViewersCheckInterval = time.Second
+
+// statsMessage reports a session's counters to a WebSocket client
+type statsMessage struct {
+	Type     string                 `json:"type"` // "stats"
+	Counters models.SessionCounters `json:"counters"`
+	// Events dropped at this client's own send buffer
+	ClientDropped int64 `json:"clientDropped"`
+}
+
+// Broadcaster is a session's output pipeline. It is started with the session
+// and drains the gadget output exactly once, persisting every event to
+// storage whether or not anyone is watching, and fans it out to any number
+// of WebSocket subscribers, each with its own send buffer. Every message is
+// also published to the session store so viewers connected to other backend
+// instances can be relayed the same stream.
+type Broadcaster struct {
+	session      *gadget.Session
+	storage      Storage
+	sessionStore SessionStore
+	mu           sync.Mutex
+	subscribers  map[*WSClient]struct{}
+	ended        bool
+	endReason    string
+	seq          int64  // Seq of the last event, only used by Run
+	onEnd        func() // Called once after the broadcaster has ended
+
+	// Whether other instances relay the session and when that was last
+	// checked, only used by Run
+	remoteViewers        bool
+	remoteViewersChecked time.Time
+}
+
+// NewBroadcaster creates a broadcaster for a session. Run must be called
+// to start draining output. Events are numbered from lastSeq+1.
+func NewBroadcaster(session *gadget.Session, storage Storage, sessionStore SessionStore, lastSeq int64, onEnd func()) *Broadcaster {
+	return &Broadcaster{
+		session:      session,
+		storage:      storage,
+		sessionStore: sessionStore,
+		seq:          lastSeq,
+		subscribers:  make(map[*WSClient]struct{}),
+		onEnd:        onEnd,
+	}
+}
+
+// Subscribe adds a client. It returns false if the session already ended.
+func (b *Broadcaster) Subscribe(client *WSClient) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ended {
+		return false
+	}
+	b.subscribers[client] = struct{}{}
+	return true
+}
+
+// Unsubscribe removes a client and closes its send channel. It returns the
+// number of remaining subscribers.
+func (b *Broadcaster) Unsubscribe(client *WSClient) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.subscribers[client]; exists {
+		delete(b.subscribers, client)
+		close(client.Send)
+	}
+	return len(b.subscribers)
+}
+
+// Run forwards the session's output and errors until the session ends
+func (b *Broadcaster) Run() {
+	outputCh := b.session.OutputCh
+	errorCh := b.session.ErrorCh
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for outputCh != nil {
+		select {
+		case output, ok := <-outputCh:
+			if !ok {
+				// Channel closed, session ended
+				outputCh = nil
+				continue
+			}
+
+			b.seq++
+			output.Seq = b.seq
+
+			// Publish to storage for persistence
+			if b.storage != nil {
+				if err := b.storage.PublishEvent(output); err != nil {
+					b.session.Counters.PersistFailed.Add(1)
+					log.Printf("Failed to publish event to storage: %v", err)
+				}
+			}
+
+			if data, err := json.Marshal(output); err == nil {
+				b.broadcast(data, &output)
+			}
+
+		case err, ok := <-errorCh:
+			if !ok {
+				errorCh = nil
+				continue
+			}
+
+			errorMsg := map[string]interface{}{
+				"type":    "error",
+				"message": err.Error(),
+			}
+			if data, err := json.Marshal(errorMsg); err == nil {
+				b.broadcast(data, nil)
+			}
+
+		case <-ticker.C:
+			b.sendStats()
+			b.syncSession()
+		}
+	}
+
+	// Final counters, so clients know whether they saw everything
+	b.sendStats()
+	b.end()
+}
+
+// sendStats sends the session's counters to every subscriber, along with the
+// number of events dropped at that subscriber's own send buffer
+func (b *Broadcaster) sendStats() {
+	counters := b.session.Counters.Snapshot()
+
+	b.mu.Lock()
+	for client := range b.subscribers {
+		data, err := json.Marshal(statsMessage{Type: "stats", Counters: counters, ClientDropped: client.dropped})
+		if err != nil {
+			continue
+		}
+		client.sendControl(data)
+	}
+	b.mu.Unlock()
+
+	// Relaying replicas fill in their own clients' drops
+	if data, err := json.Marshal(statsMessage{Type: "stats", Counters: counters}); err == nil {
+		b.relay(data)
+	}
+}
+
+// syncSession writes the session's current state, including its counters, to
+// the session store so every replica reports the same values
+func (b *Broadcaster) syncSession() {
+	if b.sessionStore == nil {
+		return
+	}
+	if err := b.sessionStore.UpdateSession(b.session.Info()); err != nil {
+		log.Printf("Failed to update session in store: %v", err)
+	}
+}
+
+// SetEndReason records why the session ended. It is sent to subscribers
+// once all remaining output has been drained.
+func (b *Broadcaster) SetEndReason(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endReason = reason
+}
+
+// end sends the session_ended message to all subscribers and disconnects them
+func (b *Broadcaster) end() {
+	b.mu.Lock()
+	if b.ended {
+		b.mu.Unlock()
+		return
+	}
+	b.ended = true
+
+	message := map[string]interface{}{
+		"type":   "session_ended",
+		"status": b.session.Status(),
+	}
+	if b.endReason != "" {
+		message["reason"] = b.endReason
+	}
+
+	data, err := json.Marshal(message)
+	for client := range b.subscribers {
+		if err == nil && client.sendFinal(data) {
+			client.dropped++
+			b.session.Counters.ClientDropped.Add(1)
+		}
+		close(client.Send)
+		delete(b.subscribers, client)
+	}
+	b.mu.Unlock()
+
+	// Relayed viewers must learn that the session ended even if they
+	// subscribed since the last check
+	if err == nil {
+		b.publish(data)
+	}
+
+	if b.onEnd != nil {
+		b.onEnd()
+	}
+}
+
+// broadcast sends a message to every subscriber without blocking. Gadget
+// events (event is set) go only to clients whose filter they match, subject
+// to the session's overflow policy, and lost events are counted; clients
+// with the block policy whose send buffer is full are disconnected. Other
+// messages go to the clients' control queues.
+func (b *Broadcaster) broadcast(data []byte, event *models.GadgetOutput) {
+	b.mu.Lock()
+	for client := range b.subscribers {
+		if event == nil {
+			client.sendControl(data)
+			continue
+		}
+		if !client.wants(event) {
+			continue
+		}
+
+		delivery, ok := client.deliver(data)
+		if delivery != gadget.Delivered {
+			client.dropped++
+			b.session.Counters.ClientDropped.Add(1)
+		}
+		if !ok {
+			delete(b.subscribers, client)
+			close(client.Send)
+		}
+	}
+	b.mu.Unlock()
+
+	b.relay(data)
+}
+
+// relay publishes a message for viewers connected to other backend
+// instances, if there are any
+func (b *Broadcaster) relay(data []byte) {
+	if b.sessionStore == nil {
+		return
+	}
+
+	if time.Since(b.remoteViewersChecked) >= remoteViewersCheckInterval {
+		subscribers, err := b.sessionStore.OutputSubscribers(b.session.ID)
+		if err != nil {
+			log.Printf("Failed to count relayed viewers: %v", err)
+		}
+		// Keep relaying if unsure rather than starving remote viewers
+		b.remoteViewers = err != nil || subscribers > 0
+		b.remoteViewersChecked = time.Now()
+	}
+
+	if b.remoteViewers {
+		b.publish(data)
+	}
+}
+
+// publish publishes a message to the session store unconditionally
+func (b *Broadcaster) publish(data []byte) {
+	if b.sessionStore == nil {
+		return
+	}
+	if err := b.sessionStore.PublishOutput(b.session.ID, data); err != nil {
+		log.Printf("Failed to relay session output: %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"inspector-gadget-management/backend/internal/filter"
+	"inspector-gadget-management/backend/internal/models"
+	"inspector-gadget-management/backend/internal/pcapng"
+
+	"github.com/gorilla/mux"
+)
+
+// exportFlushEvery is how many events are written between flushes of an
+// export to the client
+const exportFlushEvery = 1000
+
+// csvFieldSample is how many of a session's first events the CSV columns
+// are taken from, so that finding them does not scan the whole session
+const csvFieldSample = 1000
+
+// exportFormats maps the export formats to their content types
+var exportFormats = map[string]string{
+	"ndjson": "application/x-ndjson",
+	"csv":    "text/csv",
+	"json":   "application/json",
+	"pcapng": "application/x-pcapng",
+}
+
+// ExportSession streams all stored events of a session as NDJSON, CSV or a
+// JSON array, oldest first. trace_tcp sessions can also be exported as a
+// pcapng capture.
+func (h *Handler) ExportSession(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	sessionID := mux.Vars(r)["sessionId"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	contentType, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid format %q: must be ndjson, csv, json or pcapng", format), http.StatusBadRequest)
+		return
+	}
+
+	// Unknown sessions and unsupported formats can only be refused before
+	// anything is sent
+	gadgetType, err := h.storage.SessionType(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if gadgetType == "" {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if format == "pcapng" && gadgetType != models.GadgetTraceTCP {
+		http.Error(w, fmt.Sprintf("Format %s is only supported for %s sessions", format, models.GadgetTraceTCP), http.StatusBadRequest)
+		return
+	}
+
+	// CSV needs its columns before the first row
+	var fields []string
+	if format == "csv" {
+		if fields, err = h.storage.SessionEventFields(r.Context(), sessionID, csvFieldSample); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to export session: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"session-%s.%s\"", sessionID, format))
+
+	body := &exportWriter{w: w}
+	out := bufio.NewWriter(body)
+	var write func(models.GadgetOutput) error
+	var finish func() error
+
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(out)
+		write = func(event models.GadgetOutput) error { return encoder.Encode(event) }
+		finish = func() error { return nil }
+	case "json":
+		first := true
+		out.WriteString("[")
+		write = func(event models.GadgetOutput) error {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if !first {
+				out.WriteString(",")
+			}
+			first = false
+			out.WriteString("\n")
+			_, err = out.Write(data)
+			return err
+		}
+		finish = func() error {
+			_, err := out.WriteString("\n]\n")
+			return err
+		}
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.Write(append([]string{"time", "session_id", "event_type", "seq", "frame"}, fields...))
+		write = func(event models.GadgetOutput) error {
+			writer.Write(csvRecord(event, fields))
+			return writer.Error()
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case "pcapng":
+		capture := pcapng.NewWriter(out, "penny-"+sessionID)
+		write = func(event models.GadgetOutput) error {
+			packet, comment, ok := tcpPacket(event)
+			if !ok {
+				return nil
+			}
+			return capture.WritePacket(event.Timestamp, packet, comment)
+		}
+		finish = capture.Close
+	}
+
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	err = h.storage.StreamSessionEvents(r.Context(), sessionID, func(event models.GadgetOutput) error {
+		if err := write(event); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = finish()
+	}
+	if err != nil && !body.started {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("Failed to export session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// The response has started, so the client sees a truncated file
+		log.Printf("Export of session %s failed after %d events: %v", sessionID, count, err)
+		return
+	}
+	out.Flush()
+}
+
+// exportWriter records whether any of an export has been sent, after which
+// failures can no longer be reported with a status code
+type exportWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.started = true
+	return e.w.Write(p)
+}
+
+// csvRecord returns an event's CSV row for the given data fields
+func csvRecord(event models.GadgetOutput, fields []string) []string {
+	flat := make(map[string]string, len(fields))
+	flattenFields("", event.Data, flat)
+
+	record := make([]string, 0, 5+len(fields))
+	record = append(record, event.Timestamp.Format(time.RFC3339Nano), event.SessionID, event.EventType, "", "")
+	if event.Seq > 0 {
+		record[3] = strconv.FormatInt(event.Seq, 10)
+	}
+	if event.Frame > 0 {
+		record[4] = strconv.FormatInt(event.Frame, 10)
+	}
+	for _, field := range fields {
+		record = append(record, flat[field])
+	}
+	return record
+}
+
+// flattenFields renders the leaf values of nested event data under their
+// dotted paths, e.g. {"dst": {"port": 443}} becomes "dst.port" = "443".
+// Arrays are kept as JSON and nulls become empty cells.
+func flattenFields(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenFields(key, child, out)
+		}
+	case nil:
+		out[prefix] = ""
+	case string:
+		out[prefix] = v
+	case float64:
+		out[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		out[prefix] = strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		out[prefix] = string(data)
+	}
+}
+
+// tcpPacket synthesizes the packet a trace_tcp event stands for: a SYN for
+// connect, a SYN-ACK for accept and a FIN-ACK for close, sent from the
+// event's source to its destination. The comment carries the Kubernetes and
+// process metadata. Events without addresses are skipped.
+func tcpPacket(event models.GadgetOutput) ([]byte, string, bool) {
+	eventType := lookupString(event.Data, "type")
+	var flags uint8
+	var ack uint32
+	switch eventType {
+	case "connect":
+		flags = pcapng.FlagSYN
+	case "accept":
+		flags, ack = pcapng.FlagSYN|pcapng.FlagACK, 1
+	case "close":
+		flags, ack = pcapng.FlagFIN|pcapng.FlagACK, 1
+	default:
+		return nil, "", false
+	}
+
+	// Nested layout first, then the flat one of older gadget versions
+	segment := pcapng.TCPSegment{
+		Src:     net.ParseIP(lookupString(event.Data, "src.addr", "srcIp")),
+		Dst:     net.ParseIP(lookupString(event.Data, "dst.addr", "dstIp")),
+		SrcPort: uint16(lookupNumber(event.Data, "src.port", "srcPort")),
+		DstPort: uint16(lookupNumber(event.Data, "dst.port", "dstPort")),
+		Flags:   flags,
+		Ack:     ack,
+	}
+	packet, err := segment.Packet()
+	if err != nil {
+		return nil, "", false
+	}
+
+	comment := []string{eventType}
+	for _, field := range []struct{ name, value string }{
+		{"namespace", lookupString(event.Data, "k8s.namespace", "namespace")},
+		{"pod", lookupString(event.Data, "k8s.podName", "pod")},
+		{"container", lookupString(event.Data, "k8s.containerName", "container")},
+		{"node", lookupString(event.Data, "k8s.node", "node")},
+		{"comm", lookupString(event.Data, "proc.comm", "comm")},
+		{"pid", lookupString(event.Data, "proc.pid", "pid")},
+		{"dst", strings.Trim(strings.Join([]string{
+			lookupString(event.Data, "dst.k8s.kind"),
+			lookupString(event.Data, "dst.k8s.namespace"),
+			lookupString(event.Data, "dst.k8s.name"),
+		}, "/"), "/")},
+		{"error", lookupString(event.Data, "error")},
+	} {
+		if field.value != "" && field.value != "0" {
+			comment = append(comment, field.name+"="+field.value)
+		}
+	}
+
+	return packet, strings.Join(comment, " "), true
+}
+
+// lookupString returns the first of the fields present in event data,
+// formatted as text
+func lookupString(data map[string]interface{}, paths ...string) string {
+	for _, path := range paths {
+		value, _ := filter.Lookup(data, path)
+		switch v := value.(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// lookupNumber returns the first numeric field present in event data
+func lookupNumber(data map[string]interface{}, paths ...string) float64 {
+	for _, path := range paths {
+		value, _ := filter.Lookup(data, path)
+		if v, ok := value.(float64); ok {
+			return v
+		}
+	}
+	return 0
+}
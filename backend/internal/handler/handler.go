@@ -3,13 +3,17 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"inspector-gadget-management/backend/internal/filter"
 	"inspector-gadget-management/backend/internal/gadget"
 	"inspector-gadget-management/backend/internal/models"
 
@@ -21,10 +25,21 @@ import (
 // Storage interface for data persistence
 type Storage interface {
 	PublishEvent(event models.GadgetOutput) error
-	QueryEvents(ctx context.Context, filter interface{}) ([]models.GadgetOutput, error)
+	QueryEvents(ctx context.Context, filter interface{}) (*models.EventPage, error)
 	RecordSessionStart(ctx context.Context, session models.GadgetSession) error
 	RecordSessionEnd(ctx context.Context, sessionID string) error
+	RecordSessionFailure(ctx context.Context, sessionID string, reason string) error
 	GetSessionStats(ctx context.Context, sessionID string) (interface{}, error)
+	GetSessionFrames(ctx context.Context, sessionID string) (interface{}, error)
+	ImportSession(ctx context.Context, session models.GadgetSession, next func() (*models.GadgetOutput, error)) (int64, error)
+	ListDeadLetters(ctx context.Context, limit int) (interface{}, error)
+	ReplayDeadLetters(ctx context.Context, ids []string) (int, error)
+	GetStreamStats(ctx context.Context) (interface{}, error)
+	EventsSince(ctx context.Context, sessionID string, since int64) ([]models.GadgetOutput, bool, error)
+	LastSeq(ctx context.Context, sessionID string) (int64, error)
+	StreamSessionEvents(ctx context.Context, sessionID string, fn func(models.GadgetOutput) error) error
+	SessionEventFields(ctx context.Context, sessionID string, sample int) ([]string, error)
+	SessionType(ctx context.Context, sessionID string) (models.GadgetType, error)
 }
 
 // SessionStore interface for distributed session management
@@ -39,16 +54,35 @@ type SessionStore interface {
 	UnregisterWebSocket(sessionID string) error
 	GetWebSocketBackend(sessionID string) (string, error)
 	HasWebSocket(sessionID string) bool
+	PublishOutput(sessionID string, data []byte) error
+	OutputSubscribers(sessionID string) (int64, error)
+	SubscribeOutput(ctx context.Context, sessionID string) (<-chan []byte, error)
+	RecoverSessions() ([]models.GadgetSession, error)
+	ClaimSession(session models.GadgetSession) (bool, error)
+	FailSession(sessionID string, reason string) error
 	Close() error
 }
 
+// relayCheckInterval is how often a relayed WebSocket checks that its session
+// still exists
+const relayCheckInterval = 5 * time.Second
+
+// wsWriteWait bounds how long writing one message to a WebSocket may take
+// before the client is considered gone
+const wsWriteWait = 10 * time.Second
+
+// maxBackfillRounds bounds how often a resuming client's backfill is
+// queried again to catch up with a session that keeps producing output
+const maxBackfillRounds = 5
+
 // Handler manages HTTP and WebSocket handlers
 type Handler struct {
 	gadgetClient *gadget.Client
 	storage      Storage
 	sessionStore SessionStore
 	upgrader     websocket.Upgrader
-	wsClients    map[string]*WSClient
+	broadcasters map[string]*Broadcaster // Per-session output fan-out, keyed by session ID
+	failover     FailoverPolicy
 	mu           sync.RWMutex
 }
 
@@ -57,6 +91,110 @@ type WSClient struct {
 	SessionID string
 	Conn      *websocket.Conn
 	Send      chan []byte
+
+	// Live messages up to this seq were already sent as backfill
+	resumeAfter int64
+	// Events dropped because Send was full, and the session's overflow
+	// policy applied to Send. Guarded by the broadcaster's mu for local
+	// sessions, owned by the relay goroutine for relayed ones.
+	dropped  int64
+	overflow *gadget.Overflow
+
+	filter atomic.Pointer[filter.Expr] // Set by the client's subscribe message
+	// Messages other than gadget events (replies, stats, errors), kept apart
+	// from Send so overflow policies never evict them. Never closed.
+	control chan []byte
+}
+
+// newWSClient creates a client applying the given overflow policy to its
+// send buffer
+func newWSClient(sessionID string, conn *websocket.Conn, policy gadget.OverflowPolicy, sampleRate int) *WSClient {
+	return &WSClient{
+		SessionID: sessionID,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
+		overflow:  gadget.NewOverflow(policy, sampleRate),
+		control:   make(chan []byte, 8),
+	}
+}
+
+// wants reports whether an event matches the client's filter
+func (c *WSClient) wants(event *models.GadgetOutput) bool {
+	f := c.filter.Load()
+	return f == nil || f.Match(event.Data)
+}
+
+// reply sends a control message to the client without blocking
+func (c *WSClient) reply(message map[string]interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	c.sendControl(data)
+}
+
+// sendControl queues an encoded control message without blocking
+func (c *WSClient) sendControl(data []byte) {
+	select {
+	case c.control <- data:
+	default:
+		// Client is not reading its control messages
+	}
+}
+
+// deliver queues a gadget event according to the client's overflow policy
+// without blocking. A client with the block policy that can't keep up gets
+// false and must be disconnected rather than stall the session's other
+// clients; it can resume without losing events by reconnecting with since.
+func (c *WSClient) deliver(data []byte) (gadget.Delivery, bool) {
+	if c.overflow.Policy != gadget.OverflowBlock {
+		return gadget.Deliver(c.overflow, c.Send, data, nil), true
+	}
+	select {
+	case c.Send <- data:
+		return gadget.Delivered, true
+	default:
+		c.reply(map[string]interface{}{
+			"type":    "error",
+			"message": "Disconnected for falling behind, reconnect with since to resume",
+		})
+		return gadget.Dropped, false
+	}
+}
+
+// sendFinal queues the last message before Send is closed, evicting the
+// oldest buffered event if Send is full. It returns whether an event was
+// evicted.
+func (c *WSClient) sendFinal(data []byte) bool {
+	select {
+	case c.Send <- data:
+		return false
+	default:
+	}
+
+	evicted := false
+	select {
+	case <-c.Send:
+		evicted = true
+	default:
+	}
+	select {
+	case c.Send <- data:
+	default:
+	}
+	return evicted
+}
+
+// write writes one message to the client's connection
+func (c *WSClient) write(messageType int, data []byte) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// writeJSON writes one JSON message to the client's connection
+func (c *WSClient) writeJSON(v interface{}) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.Conn.WriteJSON(v)
 }
 
 // NewHandler creates a new handler
@@ -70,7 +208,8 @@ func NewHandler(gadgetClient *gadget.Client, storage Storage, sessionStore Sessi
 				return true // Allow all origins for development
 			},
 		},
-		wsClients: make(map[string]*WSClient),
+		broadcasters: make(map[string]*Broadcaster),
+		failover:     FailoverRestart,
 	}
 }
 
@@ -80,27 +219,30 @@ func (h *Handler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/gadgets", h.ListGadgets).Methods("GET")
 	r.HandleFunc("/api/sessions", h.ListSessions).Methods("GET")
 	r.HandleFunc("/api/sessions", h.StartSession).Methods("POST")
+	r.HandleFunc("/api/sessions/import", h.ImportSession).Methods("POST")
 	r.HandleFunc("/api/sessions/{sessionId}", h.StopSession).Methods("DELETE")
+	r.HandleFunc("/api/sessions/{sessionId}/extend", h.ExtendSession).Methods("POST")
+	r.HandleFunc("/api/sessions/{sessionId}/pin", h.PinSession).Methods("PUT")
 
 	// Historical data routes
 	r.HandleFunc("/api/events", h.QueryEvents).Methods("GET")
 	r.HandleFunc("/api/sessions/{sessionId}/events", h.GetSessionEvents).Methods("GET")
 	r.HandleFunc("/api/sessions/{sessionId}/stats", h.GetSessionStats).Methods("GET")
+	r.HandleFunc("/api/sessions/{sessionId}/frames", h.GetSessionFrames).Methods("GET")
+	r.HandleFunc("/api/sessions/{sessionId}/export", h.ExportSession).Methods("GET")
+
+	// Admin routes
+	r.HandleFunc("/api/admin/dead-letters", h.ListDeadLetters).Methods("GET")
+	r.HandleFunc("/api/admin/dead-letters/replay", h.ReplayDeadLetters).Methods("POST")
+	r.HandleFunc("/api/admin/stream", h.GetStreamStats).Methods("GET")
 
 	// WebSocket route
 	r.HandleFunc("/ws/{sessionId}", h.HandleWebSocket)
 }
 
-// ListGadgets returns available gadgets
+// ListGadgets returns available gadgets from the gadget registry
 func (h *Handler) ListGadgets(w http.ResponseWriter, r *http.Request) {
-	gadgets := []map[string]interface{}{
-		{
-			"type":        models.GadgetTraceTCP,
-			"name":        "Trace TCP",
-			"description": "Trace TCP connections",
-			"category":    "trace",
-		},
-	}
+	gadgets := h.gadgetClient.Registry().List()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(gadgets)
@@ -141,22 +283,20 @@ func (h *Handler) StartSession(w http.ResponseWriter, r *http.Request) {
 	// Use background context so gadget continues running after HTTP request completes
 	session, err := h.gadgetClient.RunGadget(context.Background(), req, sessionID)
 	if err != nil {
+		var validationErr *gadget.ValidationError
+		if errors.As(err, &validationErr) {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to start gadget: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	response := models.GadgetSession{
-		ID:          session.ID,
-		Type:        session.Type,
-		Namespace:   session.Namespace,
-		PodName:     session.PodName,
-		Status:      session.Status,
-		StartTime:   session.StartTime,
-		Timeout:     session.Timeout,
-		AcceptOnly:  session.AcceptOnly,
-		ConnectOnly: session.ConnectOnly,
-		FailureOnly: session.FailureOnly,
-	}
+	// Start the session's output pipeline so events are persisted even if
+	// no WebSocket client ever connects
+	h.broadcasterFor(session, 0)
+
+	response := session.Info()
 
 	// Store session in distributed session store
 	if h.sessionStore != nil {
@@ -212,6 +352,103 @@ func (h *Handler) StopSession(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ExtendSession moves the deadline of a running session further out
+func (h *Handler) ExtendSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID := vars["sessionId"]
+
+	var req struct {
+		Seconds int `json:"seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !h.ownsSession(w, sessionID) {
+		return
+	}
+
+	session, err := h.gadgetClient.ExtendSession(sessionID, time.Duration(req.Seconds)*time.Second)
+	if err != nil {
+		h.writeSessionError(w, err)
+		return
+	}
+
+	h.writeSessionUpdate(w, session)
+}
+
+// PinSession pins or unpins a running session. Pinned sessions have no
+// deadline and run until explicitly stopped.
+func (h *Handler) PinSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID := vars["sessionId"]
+
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !h.ownsSession(w, sessionID) {
+		return
+	}
+
+	session, err := h.gadgetClient.SetPinned(sessionID, req.Pinned)
+	if err != nil {
+		h.writeSessionError(w, err)
+		return
+	}
+
+	h.writeSessionUpdate(w, session)
+}
+
+// ownsSession checks that the session runs on this backend instance, writing
+// an error response if it does not
+func (h *Handler) ownsSession(w http.ResponseWriter, sessionID string) bool {
+	if _, exists := h.gadgetClient.GetSession(sessionID); exists {
+		return true
+	}
+
+	if h.sessionStore != nil {
+		if session, err := h.sessionStore.GetSession(sessionID); err == nil && session != nil {
+			// Session is on a different backend
+			http.Error(w, "Session is on a different backend instance", http.StatusBadGateway)
+			return false
+		}
+	}
+
+	http.Error(w, "Session not found", http.StatusNotFound)
+	return false
+}
+
+// writeSessionError writes the error response for a failed session update
+func (h *Handler) writeSessionError(w http.ResponseWriter, err error) {
+	var validationErr *gadget.ValidationError
+	if errors.As(err, &validationErr) {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Session not found: %v", err), http.StatusNotFound)
+}
+
+// writeSessionUpdate syncs an updated session to the session store so every
+// replica reports the same deadline, and writes it as the response
+func (h *Handler) writeSessionUpdate(w http.ResponseWriter, session *gadget.Session) {
+	response := session.Info()
+
+	if h.sessionStore != nil {
+		if err := h.sessionStore.UpdateSession(response); err != nil {
+			log.Printf("Failed to update session in store: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // CleanupSession cleans up session state when a session ends (timeout, manual stop, or error)
 func (h *Handler) CleanupSession(sessionID string, reason string) {
 	log.Printf("Cleaning up session %s (reason: %s)", sessionID, reason)
@@ -233,24 +470,14 @@ func (h *Handler) CleanupSession(sessionID string, reason string) {
 		}
 	}
 
-	// Close WebSocket connections for this session and notify clients
-	h.mu.Lock()
-	if client, exists := h.wsClients[sessionID]; exists {
-		message := map[string]interface{}{
-			"type":   "session_ended",
-			"reason": reason,
-		}
-		if data, err := json.Marshal(message); err == nil {
-			select {
-			case client.Send <- data:
-			default:
-				// Client send buffer full
-			}
-		}
-		close(client.Send)
-		delete(h.wsClients, sessionID)
+	// WebSocket clients are notified and disconnected by the session's
+	// pipeline once the remaining output has been persisted
+	h.mu.RLock()
+	broadcaster, exists := h.broadcasters[sessionID]
+	h.mu.RUnlock()
+	if exists {
+		broadcaster.SetEndReason(reason)
 	}
-	h.mu.Unlock()
 
 	log.Printf("Session %s cleanup completed", sessionID)
 }
@@ -260,16 +487,44 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
+	// Only forward events matching the filter expression. Clients can
+	// change it later with a subscribe message.
+	var clientFilter *filter.Expr
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		var err error
+		clientFilter, err = filter.Parse(expr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid filter: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A reconnecting client passes the seq of the last event it received to
+	// be sent the events it missed
+	since := int64(-1)
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		var err error
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Check if this backend has the local gadget session
 	session, exists := h.gadgetClient.GetSession(sessionID)
 	if !exists {
 		// Session not found locally
-		// In a distributed setup, check if another backend has it
+		// In a distributed setup, relay it from the backend that owns it
 		if h.sessionStore != nil {
-			backendID, err := h.sessionStore.GetWebSocketBackend(sessionID)
-			if err == nil && backendID != h.sessionStore.GetInstanceID() {
-				// Session is on a different backend
-				http.Error(w, "Session is on a different backend instance", http.StatusBadGateway)
+			stored, err := h.sessionStore.GetSession(sessionID)
+			if err == nil && stored.Status == "failed" {
+				// Kept only to report why it failed; there is nothing to relay
+				h.endWebSocket(w, r, failedSessionEnded(*stored))
+				return
+			}
+			if err == nil && stored.Owner != h.sessionStore.GetInstanceID() {
+				h.relayWebSocket(w, r, *stored, since, clientFilter)
 				return
 			}
 		}
@@ -283,6 +538,27 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client := newWSClient(sessionID, conn, session.OverflowPolicy, session.SampleRate)
+	client.filter.Store(clientFilter)
+
+	broadcaster := h.broadcasterFor(session, 0)
+	subscribe := func() bool { return broadcaster.Subscribe(client) }
+	var subscribed bool
+	if since >= 0 {
+		subscribed = h.backfill(client, since, subscribe)
+	} else {
+		subscribed = subscribe()
+	}
+	if !subscribed {
+		// Session ended between the lookup and subscribing
+		conn.WriteJSON(map[string]interface{}{
+			"type":   "session_ended",
+			"status": session.Status(),
+		})
+		conn.Close()
+		return
+	}
+
 	// Register WebSocket in session store
 	if h.sessionStore != nil {
 		if err := h.sessionStore.RegisterWebSocket(sessionID); err != nil {
@@ -291,119 +567,382 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	client := &WSClient{
-		SessionID: sessionID,
-		Conn:      conn,
-		Send:      make(chan []byte, 256),
+	// Start goroutines for reading and writing
+	detach := func() { h.unsubscribe(client, broadcaster) }
+	go h.wsWriter(client, detach)
+	go h.wsReader(client, detach)
+}
+
+// relayWebSocket serves a WebSocket client for a session running on another
+// backend instance by relaying the output its owner publishes
+func (h *Handler) relayWebSocket(w http.ResponseWriter, r *http.Request, stored models.GadgetSession, since int64, clientFilter *filter.Expr) {
+	sessionID := stored.ID
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Subscribe before upgrading so a failure can still be reported over HTTP
+	messages, err := h.sessionStore.SubscribeOutput(ctx, sessionID)
+	if err != nil {
+		cancel()
+		log.Printf("Failed to subscribe to session output: %v", err)
+		http.Error(w, "Failed to relay session from its backend instance", http.StatusBadGateway)
+		return
 	}
 
-	h.mu.Lock()
-	h.wsClients[sessionID] = client
-	h.mu.Unlock()
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		cancel()
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
 
-	// Start goroutines for reading and writing
-	go h.wsWriter(client)
-	go h.wsReader(client)
-	go h.forwardGadgetOutput(session, client)
+	var policy gadget.OverflowPolicy
+	var sampleRate int
+	if stored.Request != nil {
+		policy = gadget.OverflowPolicy(stored.Request.OverflowPolicy)
+		sampleRate = stored.Request.SampleRate
+	}
+	client := newWSClient(sessionID, conn, policy, sampleRate)
+	client.filter.Store(clientFilter)
+
+	// Relayed output is buffered by the subscription meanwhile
+	if since >= 0 {
+		h.backfill(client, since, func() bool { return true })
+	}
+
+	go h.relayOutput(ctx, client, messages)
+	go h.wsWriter(client, cancel)
+	go h.wsReader(client, cancel)
 }
 
-// wsWriter writes messages to WebSocket
-func (h *Handler) wsWriter(client *WSClient) {
-	defer func() {
-		client.Conn.Close()
-		h.mu.Lock()
-		delete(h.wsClients, client.SessionID)
-		h.mu.Unlock()
+// failedSessionEnded is the session_ended message of a failed session
+func failedSessionEnded(stored models.GadgetSession) map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "session_ended",
+		"status": "failed",
+		"reason": stored.Reason,
+	}
+}
 
-		// Unregister WebSocket from session store
-		if h.sessionStore != nil {
-			if err := h.sessionStore.UnregisterWebSocket(client.SessionID); err != nil {
-				log.Printf("Failed to unregister WebSocket: %v", err)
+// endWebSocket accepts a WebSocket connection only to send a final message
+// and close it
+func (h *Handler) endWebSocket(w http.ResponseWriter, r *http.Request, message map[string]interface{}) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	conn.WriteJSON(message)
+	conn.Close()
+}
+
+// relayOutput forwards relayed messages to a client until the session ends or
+// the client disconnects, then closes the client's send channel
+func (h *Handler) relayOutput(ctx context.Context, client *WSClient, messages <-chan []byte) {
+	defer close(client.Send)
+
+	// The owner may die without publishing session_ended, so periodically
+	// check that the session still exists
+	ticker := time.NewTicker(relayCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var message struct {
+				Type string `json:"type"`
+				Seq  int64  `json:"seq"`
+			}
+			json.Unmarshal(data, &message)
+
+			if message.Type == "stats" {
+				// Report this client's own drops instead of the owner's
+				var stats statsMessage
+				if json.Unmarshal(data, &stats) == nil {
+					stats.ClientDropped = client.dropped
+					if patched, err := json.Marshal(stats); err == nil {
+						data = patched
+					}
+				}
+			}
+
+			if message.Seq != 0 && client.filter.Load() != nil {
+				var event models.GadgetOutput
+				if json.Unmarshal(data, &event) == nil && !client.wants(&event) {
+					continue
+				}
+			}
+
+			switch {
+			case message.Seq != 0:
+				delivery, ok := client.deliver(data)
+				if delivery != gadget.Delivered {
+					client.dropped++
+				}
+				if !ok {
+					return
+				}
+			case message.Type == "session_ended":
+				if client.sendFinal(data) {
+					client.dropped++
+				}
+				return
+			default:
+				client.sendControl(data)
+			}
+
+		case <-ticker.C:
+			stored, err := h.sessionStore.GetSession(client.SessionID)
+			if err != nil {
+				data, _ := json.Marshal(map[string]interface{}{
+					"type":   "session_ended",
+					"status": "unknown",
+					"reason": "session_lost",
+				})
+				client.sendFinal(data)
+				return
+			}
+			if stored.Status == "failed" {
+				data, _ := json.Marshal(failedSessionEnded(*stored))
+				client.sendFinal(data)
+				return
 			}
+
+		case <-ctx.Done():
+			return
 		}
-	}()
+	}
+}
 
-	for {
-		message, ok := <-client.Send
+// backfill writes the events a reconnecting client missed after since
+// directly to its connection, then attaches the client to live output with
+// attach and returns its result. Storage is queried again until it has
+// caught up before attaching, so that only the events stored while
+// attaching are written afterwards, and live output doesn't pile up in the
+// client's send buffer while the bulk of the backfill is written.
+func (h *Handler) backfill(client *WSClient, since int64, attach func() bool) bool {
+	if h.storage == nil {
+		client.writeJSON(map[string]interface{}{
+			"type":    "error",
+			"message": "Cannot resume stream: storage not configured",
+		})
+		return attach()
+	}
+
+	// Live messages up to the last backfilled seq are skipped by wsWriter
+	defer func() { client.resumeAfter = since }()
+
+	for round := 0; round < maxBackfillRounds; round++ {
+		read, ok := h.writeMissed(client, &since)
 		if !ok {
-			client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-			return
+			return attach()
+		}
+		if read == 0 {
+			break
 		}
+	}
 
-		if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("WebSocket write error: %v", err)
-			return
+	attached := attach()
+	h.writeMissed(client, &since)
+	return attached
+}
+
+// writeMissed writes the stored events after *since to the client's
+// connection, advancing *since past them. It returns how many events were
+// read and false if the client can't be resumed.
+func (h *Handler) writeMissed(client *WSClient, since *int64) (int, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	events, truncated, err := h.storage.EventsSince(ctx, client.SessionID, *since)
+	if err != nil {
+		log.Printf("Failed to backfill session %s: %v", client.SessionID, err)
+		client.writeJSON(map[string]interface{}{
+			"type":    "error",
+			"message": "Failed to resume stream",
+		})
+		return 0, false
+	}
+
+	if truncated {
+		// Only the newest events are resumed; tell the client which ones it
+		// won't get
+		client.writeJSON(map[string]interface{}{
+			"type":   "gap",
+			"after":  *since,
+			"before": events[0].Seq,
+		})
+	}
+
+	for _, event := range events {
+		*since = event.Seq
+		if !client.wants(&event) {
+			continue
+		}
+		if err := client.writeJSON(event); err != nil {
+			return len(events), false
 		}
 	}
+	return len(events), true
 }
 
-// wsReader reads messages from WebSocket (for keepalive)
-func (h *Handler) wsReader(client *WSClient) {
-	defer client.Conn.Close()
+// broadcasterFor returns the session's output pipeline, starting it if needed.
+// A newly started pipeline numbers events from lastSeq+1.
+func (h *Handler) broadcasterFor(session *gadget.Session, lastSeq int64) *Broadcaster {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	for {
-		_, _, err := client.Conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket read error: %v", err)
-			}
-			break
+	if broadcaster, exists := h.broadcasters[session.ID]; exists {
+		return broadcaster
+	}
+
+	var broadcaster *Broadcaster
+	broadcaster = NewBroadcaster(session, h.storage, h.sessionStore, lastSeq, func() {
+		h.mu.Lock()
+		if h.broadcasters[session.ID] == broadcaster {
+			delete(h.broadcasters, session.ID)
 		}
+		h.mu.Unlock()
+	})
+	h.broadcasters[session.ID] = broadcaster
+	go broadcaster.Run()
+
+	return broadcaster
+}
+
+// unsubscribe detaches a client from its broadcaster, unregistering the
+// session's WebSocket from the session store once the last viewer is gone
+func (h *Handler) unsubscribe(client *WSClient, broadcaster *Broadcaster) {
+	if broadcaster.Unsubscribe(client) > 0 || h.sessionStore == nil {
+		return
+	}
+	if err := h.sessionStore.UnregisterWebSocket(client.SessionID); err != nil {
+		log.Printf("Failed to unregister WebSocket: %v", err)
 	}
 }
 
-// forwardGadgetOutput forwards gadget output to WebSocket client
-func (h *Handler) forwardGadgetOutput(session *gadget.Session, client *WSClient) {
+// wsWriter writes messages to WebSocket, control messages first. detach
+// stops the client's message source, which then closes its send channel.
+func (h *Handler) wsWriter(client *WSClient, detach func()) {
+	defer func() {
+		client.Conn.Close()
+		detach()
+	}()
+
+	writeControl := func(reply []byte) bool {
+		if err := client.write(websocket.TextMessage, reply); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			return false
+		}
+		return true
+	}
+
 	for {
 		select {
-		case output, ok := <-session.OutputCh:
-			if !ok {
-				// Channel closed, session ended
-				message := map[string]interface{}{
-					"type":   "session_ended",
-					"status": session.Status,
-				}
-				if data, err := json.Marshal(message); err == nil {
-					client.Send <- data
-				}
-				close(client.Send)
+		case reply := <-client.control:
+			if !writeControl(reply) {
 				return
 			}
+			continue
+		default:
+		}
 
-			// Publish to storage for persistence
-			if h.storage != nil {
-				if err := h.storage.PublishEvent(output); err != nil {
-					log.Printf("Failed to publish event to storage: %v", err)
-				}
+		var message []byte
+		select {
+		case reply := <-client.control:
+			if !writeControl(reply) {
+				return
 			}
-
-			// Forward output to WebSocket
-			if data, err := json.Marshal(output); err == nil {
-				select {
-				case client.Send <- data:
-				default:
-					// Client send buffer full, skip message
+			continue
+		case msg, ok := <-client.Send:
+			if !ok {
+				// Flush the reason the client was disconnected, if any
+				for len(client.control) > 0 {
+					if !writeControl(<-client.control) {
+						return
+					}
 				}
+				client.write(websocket.CloseMessage, []byte{})
+				return
 			}
+			message = msg
+		}
 
-		case err, ok := <-session.ErrorCh:
-			if !ok {
+		// Skip live messages that were already sent as backfill
+		if client.resumeAfter > 0 {
+			seq := messageSeq(message)
+			if seq != 0 && seq <= client.resumeAfter {
 				continue
 			}
+			if seq > client.resumeAfter {
+				client.resumeAfter = 0
+			}
+		}
+
+		if err := client.write(websocket.TextMessage, message); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			return
+		}
+	}
+}
+
+// messageSeq returns the seq of a gadget output message, or 0 for other messages
+func messageSeq(data []byte) int64 {
+	var message struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return 0
+	}
+	return message.Seq
+}
+
+// wsReader reads messages from WebSocket: keepalives, and subscribe messages
+// setting the client's filter, e.g. {"type":"subscribe","filter":"error != 0"}
+func (h *Handler) wsReader(client *WSClient, detach func()) {
+	defer func() {
+		client.Conn.Close()
+		detach()
+	}()
 
-			// Forward error to WebSocket
-			errorMsg := map[string]interface{}{
-				"type":    "error",
-				"message": err.Error(),
+	for {
+		_, data, err := client.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket read error: %v", err)
 			}
-			if data, err := json.Marshal(errorMsg); err == nil {
-				select {
-				case client.Send <- data:
-				default:
-					// Client send buffer full, skip message
-				}
+			break
+		}
+
+		var message struct {
+			Type   string `json:"type"`
+			Filter string `json:"filter"`
+		}
+		if json.Unmarshal(data, &message) != nil || message.Type != "subscribe" {
+			continue
+		}
+
+		// An empty filter forwards every event again
+		var expr *filter.Expr
+		if message.Filter != "" {
+			expr, err = filter.Parse(message.Filter)
+			if err != nil {
+				client.reply(map[string]interface{}{
+					"type":    "error",
+					"message": fmt.Sprintf("Invalid filter: %v", err),
+				})
+				continue
 			}
 		}
+		client.filter.Store(expr)
+		client.reply(map[string]interface{}{
+			"type":   "subscribed",
+			"filter": message.Filter,
+		})
 	}
 }
 
@@ -416,43 +955,108 @@ func (h *Handler) QueryEvents(w http.ResponseWriter, r *http.Request) {
 
 	// Parse query parameters
 	query := r.URL.Query()
+
+	// Predicates on the event payload, e.g. q=dst.port == 443 && error != 0
+	var payloadQuery *filter.Expr
+	if q := query.Get("q"); q != "" {
+		var err error
+		if payloadQuery, err = filter.Parse(q); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
 	
-	filter := map[string]interface{}{
+	eventFilter := map[string]interface{}{
 		"event_type": query.Get("event_type"),
 		"namespace":  query.Get("namespace"),
 		"session_id": query.Get("session_id"),
+		"query":      payloadQuery,
 	}
 
 	// Parse time range
 	if startStr := query.Get("start_time"); startStr != "" {
 		if startTime, err := time.Parse(time.RFC3339, startStr); err == nil {
-			filter["start_time"] = startTime
+			eventFilter["start_time"] = startTime
 		}
 	}
 	if endStr := query.Get("end_time"); endStr != "" {
 		if endTime, err := time.Parse(time.RFC3339, endStr); err == nil {
-			filter["end_time"] = endTime
+			eventFilter["end_time"] = endTime
 		}
 	}
 
-	// Parse limit
-	if limitStr := query.Get("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil {
-			filter["limit"] = limit
-		}
+	if err := parsePage(query, eventFilter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	events, err := h.storage.QueryEvents(r.Context(), filter)
+	page, err := h.storage.QueryEvents(r.Context(), eventFilter)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	writeEventPage(w, page, eventFilter)
+}
+
+// writeEventPage writes a page of events, or only its events for queries
+// that are not paged
+func writeEventPage(w http.ResponseWriter, page *models.EventPage, eventFilter map[string]interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	if paged, _ := eventFilter["paged"].(bool); !paged {
+		json.NewEncoder(w).Encode(page.Events)
+		return
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+// parsePage adds the limit, order and cursor query parameters of a paged
+// event query to its storage filter. Queries with neither a limit nor a
+// cursor are not paged and are answered with a bare array of events, as
+// before paging existed.
+func parsePage(query url.Values, eventFilter map[string]interface{}) error {
+	eventFilter["paged"] = query.Has("limit") || query.Has("cursor")
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		return err
+	}
+	if limit > 0 {
+		eventFilter["limit"] = limit
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "desc", "asc":
+		eventFilter["order"] = order
+	default:
+		return fmt.Errorf("invalid order %q: must be asc or desc", order)
+	}
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, err := models.ParseEventCursor(cursorStr)
+		if err != nil {
+			return err
+		}
+		eventFilter["cursor"] = cursor
+	}
+
+	return nil
+}
+
+// parseLimit returns the limit query parameter, or 0 without one
+func parseLimit(query url.Values) (int, error) {
+	limitStr := query.Get("limit")
+	if limitStr == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q: must be a positive integer", limitStr)
+	}
+	return limit, nil
 }
 
-// GetSessionEvents retrieves all events for a specific session
+// GetSessionEvents retrieves a page of events for a specific session
 func (h *Handler) GetSessionEvents(w http.ResponseWriter, r *http.Request) {
 	if h.storage == nil {
 		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
@@ -462,25 +1066,29 @@ func (h *Handler) GetSessionEvents(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	filter := map[string]interface{}{
+	eventFilter := map[string]interface{}{
 		"session_id": sessionID,
 	}
 
-	// Parse limit from query params
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil {
-			filter["limit"] = limit
+	if err := parsePage(r.URL.Query(), eventFilter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parse frame for stepping through interval (top) gadget sessions
+	if frameStr := r.URL.Query().Get("frame"); frameStr != "" {
+		if frame, err := strconv.ParseInt(frameStr, 10, 64); err == nil {
+			eventFilter["frame"] = frame
 		}
 	}
 
-	events, err := h.storage.QueryEvents(r.Context(), filter)
+	page, err := h.storage.QueryEvents(r.Context(), eventFilter)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to query session events: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	writeEventPage(w, page, eventFilter)
 }
 
 // GetSessionStats retrieves statistics for a session
@@ -502,3 +1110,23 @@ func (h *Handler) GetSessionStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
+
+// GetSessionFrames lists the frames of an interval (top) gadget session
+func (h *Handler) GetSessionFrames(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	vars := mux.Vars(r)
+	sessionID := vars["sessionId"]
+
+	frames, err := h.storage.GetSessionFrames(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get session frames: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(frames)
+}
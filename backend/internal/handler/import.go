@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"inspector-gadget-management/backend/internal/gadget"
+	"inspector-gadget-management/backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// maxImportBytes bounds the size of an import's body
+const maxImportBytes = 256 << 20
+
+// errNoImportEvents rejects an import without any events
+var errNoImportEvents = errors.New("no events to import")
+
+// ImportSession stores events captured elsewhere as a new session with
+// status "imported". The body holds a sequence of JSON values, usually one
+// per line: events exported by PENNY, or raw gadget output from
+// kubectl-gadget -o json, which needs ?type= to know the gadget. JSON arrays
+// are unpacked; for raw output of interval (top) gadgets each array is a
+// frame. Bodies over maxImportBytes are refused.
+func (h *Handler) ImportSession(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, "Storage not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	var def *gadget.Definition
+	if gadgetType := query.Get("type"); gadgetType != "" {
+		var ok bool
+		if def, ok = h.gadgetClient.Registry().Lookup(models.GadgetType(gadgetType)); !ok {
+			http.Error(w, fmt.Sprintf("Unknown gadget type: %s", gadgetType), http.StatusBadRequest)
+			return
+		}
+	}
+
+	session := models.GadgetSession{
+		ID:        uuid.New().String(),
+		Namespace: query.Get("namespace"),
+		PodName:   query.Get("podName"),
+	}
+	if def != nil {
+		session.Type = def.Type
+	}
+
+	// Without ?type= the session's type comes from the first exported event
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	reader := newImportReader(body, def, time.Now())
+	first, err := reader.next()
+	if err == nil && first == nil {
+		err = errNoImportEvents
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import session: %v", err), importErrorStatus(err))
+		return
+	}
+	if session.Type == "" {
+		if _, ok := h.gadgetClient.Registry().Lookup(models.GadgetType(first.EventType)); !ok {
+			http.Error(w, fmt.Sprintf("Unknown gadget type: %s", first.EventType), http.StatusBadRequest)
+			return
+		}
+		session.Type = models.GadgetType(first.EventType)
+	}
+
+	next := func() (*models.GadgetOutput, error) {
+		if first != nil {
+			event := first
+			first = nil
+			return event, nil
+		}
+		return reader.next()
+	}
+
+	if _, err := h.storage.ImportSession(r.Context(), session, next); err != nil {
+		status := http.StatusInternalServerError
+		if reader.err != nil {
+			status = importErrorStatus(reader.err)
+		}
+		http.Error(w, fmt.Sprintf("Failed to import session: %v", err), status)
+		return
+	}
+
+	stats, err := h.storage.GetSessionStats(r.Context(), session.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get session stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// importErrorStatus is the status for malformed or oversized input
+func importErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// importReader decodes the events of an import, see ImportSession
+type importReader struct {
+	decoder *json.Decoder
+	def     *gadget.Definition // nil when the upload names no gadget type
+	// eventType is the gadget type all events must have, once known
+	eventType string
+	now       time.Time         // timestamp for raw events without one
+	pending   []json.RawMessage // rest of the array being unpacked
+	frame     int64             // frame of the pending raw events, if any
+	frames    int64
+	seq       int64
+	// err is the first malformed input, as opposed to storage errors
+	err error
+}
+
+func newImportReader(body io.Reader, def *gadget.Definition, now time.Time) *importReader {
+	reader := &importReader{decoder: json.NewDecoder(bufio.NewReader(body)), def: def, now: now}
+	if def != nil {
+		reader.eventType = string(def.Type)
+	}
+	return reader
+}
+
+// next returns the following event, or nil at the end of the input
+func (r *importReader) next() (*models.GadgetOutput, error) {
+	for len(r.pending) == 0 {
+		var value json.RawMessage
+		if err := r.decoder.Decode(&value); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, r.fail(fmt.Errorf("invalid JSON after %d events: %w", r.seq, err))
+		}
+
+		value = bytes.TrimSpace(value)
+		if len(value) > 0 && value[0] == '[' {
+			if err := json.Unmarshal(value, &r.pending); err != nil {
+				return nil, r.fail(err)
+			}
+			r.frame = 0
+			if r.def != nil && r.def.OutputMode == gadget.OutputInterval {
+				r.frames++
+				r.frame = r.frames
+			}
+		} else {
+			r.pending = []json.RawMessage{value}
+			r.frame = 0
+		}
+	}
+
+	value := r.pending[0]
+	r.pending = r.pending[1:]
+
+	event, err := r.decode(value)
+	if err != nil {
+		return nil, r.fail(fmt.Errorf("event %d: %w", r.seq+1, err))
+	}
+
+	// Renumber so the imported session reads like a native one
+	r.seq++
+	event.Seq = r.seq
+	return event, nil
+}
+
+// decode converts one JSON object into an event. Objects with "eventType"
+// and a "data" object were exported by PENNY; anything else is the raw
+// output of the gadget named by the upload.
+func (r *importReader) decode(value json.RawMessage) (*models.GadgetOutput, error) {
+	var object map[string]interface{}
+	if err := json.Unmarshal(value, &object); err != nil || object == nil {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	if data, ok := object["data"].(map[string]interface{}); ok {
+		if _, ok := object["eventType"].(string); ok {
+			var event models.GadgetOutput
+			if err := json.Unmarshal(value, &event); err != nil {
+				return nil, err
+			}
+			event.Data = data
+			if event.Timestamp.IsZero() {
+				event.Timestamp = r.now
+			}
+			if r.eventType == "" {
+				r.eventType = event.EventType
+			}
+			if event.EventType != r.eventType {
+				return nil, fmt.Errorf("event type %s does not match %s", event.EventType, r.eventType)
+			}
+			return &event, nil
+		}
+	}
+
+	if r.def == nil {
+		return nil, fmt.Errorf("raw gadget output needs the gadget type, e.g. ?type=trace_tcp")
+	}
+	event := &models.GadgetOutput{
+		EventType: string(r.def.Type),
+		Timestamp: rawTimestamp(value, r.now),
+		Data:      object,
+		Frame:     r.frame,
+	}
+	if event.Frame > 0 {
+		event.FrameTime = &event.Timestamp
+	}
+	return event, nil
+}
+
+func (r *importReader) fail(err error) error {
+	if r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// rawTimestamp reads a raw gadget event's timestamp: an RFC 3339 string, or
+// nanoseconds since the epoch as newer gadgets report in timestamp_raw. The
+// fields are decoded again from the raw object since nanosecond epochs do
+// not fit in the float64 of its decoded map.
+func rawTimestamp(value json.RawMessage, fallback time.Time) time.Time {
+	var fields struct {
+		Timestamp    json.RawMessage `json:"timestamp"`
+		TimestampRaw json.RawMessage `json:"timestamp_raw"`
+	}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return fallback
+	}
+
+	var s string
+	if err := json.Unmarshal(fields.Timestamp, &s); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+	}
+	for _, raw := range []json.RawMessage{fields.TimestampRaw, fields.Timestamp} {
+		var ns int64
+		if err := json.Unmarshal(raw, &ns); err == nil && ns > 0 {
+			return time.Unix(0, ns)
+		}
+	}
+	return fallback
+}
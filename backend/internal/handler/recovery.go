@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"inspector-gadget-management/backend/internal/models"
+)
+
+// FailoverPolicy controls what happens to sessions whose backend instance died
+type FailoverPolicy string
+
+const (
+	// FailoverRestart restarts orphaned sessions on a surviving instance
+	FailoverRestart FailoverPolicy = "restart"
+	// FailoverFail marks orphaned sessions as failed
+	FailoverFail FailoverPolicy = "fail"
+)
+
+// DefaultReaperInterval is how often orphaned sessions are looked for
+const DefaultReaperInterval = 10 * time.Second
+
+// SetFailoverPolicy sets how orphaned sessions are recovered
+func (h *Handler) SetFailoverPolicy(policy FailoverPolicy) {
+	h.failover = policy
+}
+
+// RunReaper periodically adopts the sessions of dead backend instances until
+// ctx is done. It requires a session store.
+func (h *Handler) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.recoverSessions()
+		}
+	}
+}
+
+// recoverSessions claims every orphaned session and restarts it or marks it
+// failed according to the failover policy
+func (h *Handler) recoverSessions() {
+	orphaned, err := h.sessionStore.RecoverSessions()
+	if err != nil {
+		log.Printf("Failed to recover sessions: %v", err)
+		return
+	}
+
+	for _, orphan := range orphaned {
+		claimed, err := h.sessionStore.ClaimSession(orphan)
+		if err != nil {
+			log.Printf("Failed to claim session %s: %v", orphan.ID, err)
+			continue
+		}
+		if !claimed {
+			// Another instance got there first
+			continue
+		}
+
+		log.Printf("Adopting session %s from dead backend instance %q", orphan.ID, orphan.Owner)
+
+		if h.failover != FailoverRestart || orphan.Request == nil {
+			h.failSession(orphan.ID, "backend_lost")
+			continue
+		}
+		if err := h.restartSession(orphan); err != nil {
+			log.Printf("Failed to restart session %s: %v", orphan.ID, err)
+			h.failSession(orphan.ID, fmt.Sprintf("restart_failed: %v", err))
+		}
+	}
+}
+
+// restartSession re-runs an orphaned session's original request on this
+// backend instance, keeping its ID and remaining deadline
+func (h *Handler) restartSession(orphan models.GadgetSession) error {
+	req := *orphan.Request
+	req.Pinned = orphan.Pinned
+	if !orphan.Pinned && orphan.Deadline != nil {
+		remaining := time.Until(*orphan.Deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("deadline passed while the backend instance was down")
+		}
+		req.TimeoutSeconds = int(math.Ceil(remaining.Seconds()))
+	}
+
+	// Continue numbering events where the dead instance left off
+	var lastSeq int64
+	if h.storage != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		seq, err := h.storage.LastSeq(ctx, orphan.ID)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to find last event: %w", err)
+		}
+		lastSeq = seq
+	}
+
+	session, err := h.gadgetClient.RunGadget(context.Background(), req, orphan.ID)
+	if err != nil {
+		return err
+	}
+	h.broadcasterFor(session, lastSeq)
+
+	info := session.Info()
+	if err := h.sessionStore.UpdateSession(info); err != nil {
+		log.Printf("Failed to update session in store: %v", err)
+	}
+
+	if h.storage != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := h.storage.RecordSessionStart(ctx, info); err != nil {
+			log.Printf("Failed to record session start: %v", err)
+		}
+	}
+
+	log.Printf("Restarted session %s on this backend instance", orphan.ID)
+	return nil
+}
+
+// failSession marks a session failed in the session store and in storage
+func (h *Handler) failSession(sessionID string, reason string) {
+	if err := h.sessionStore.FailSession(sessionID, reason); err != nil {
+		log.Printf("Failed to mark session %s failed: %v", sessionID, err)
+	}
+
+	if h.storage != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := h.storage.RecordSessionFailure(ctx, sessionID, reason); err != nil {
+			log.Printf("Failed to record session failure: %v", err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"inspector-gadget-management/backend/internal/gadget"
+	"inspector-gadget-management/backend/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// newReplayServer serves the API with gadgets replayed from the demo
+// recordings, without storage or a session store
+func newReplayServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	gadgetClient := gadget.NewClient()
+	gadgetClient.SetRunner(&gadget.ReplayRunner{
+		Dir:       "../../../demo/recordings",
+		Speed:     100,
+		Loop:      true,
+		LoopPause: 10 * time.Millisecond,
+	})
+
+	h := NewHandler(gadgetClient, nil, nil)
+	gadgetClient.SetSessionEndedCallback(h.CleanupSession)
+
+	router := mux.NewRouter()
+	h.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReplaySessionEvents(t *testing.T) {
+	server := newReplayServer(t)
+
+	body, _ := json.Marshal(models.GadgetRequest{Type: "trace_tcp", Namespace: "fruits"})
+	resp, err := http.Post(server.URL+"/api/sessions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("start session: status %d", resp.StatusCode)
+	}
+	var session models.GadgetSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatalf("decode session: %v", err)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/" + session.ID
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	// The recording loops, so events keep arriving however late the client
+	// subscribed
+	var lastSeq int64
+	for received := 0; received < 5; {
+		var event models.GadgetOutput
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		if event.Seq == 0 {
+			// stats and other control messages
+			continue
+		}
+		if event.SessionID != session.ID {
+			t.Errorf("event session = %q, want %q", event.SessionID, session.ID)
+		}
+		if event.Seq <= lastSeq {
+			t.Errorf("event seq %d after %d", event.Seq, lastSeq)
+		}
+		if _, ok := event.Data["src"]; !ok {
+			t.Errorf("event %d has no src: %v", event.Seq, event.Data)
+		}
+		lastSeq = event.Seq
+		received++
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/sessions/"+session.ID, nil)
+	stopResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stop session: %v", err)
+	}
+	stopResp.Body.Close()
+	if stopResp.StatusCode != http.StatusNoContent {
+		t.Fatalf("stop session: status %d", stopResp.StatusCode)
+	}
+
+	// The stream ends with session_ended once the session stopped, and
+	// stopping isn't reported as an error
+	for {
+		var message map[string]interface{}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("read until session_ended: %v", err)
+		}
+		switch message["type"] {
+		case "error":
+			t.Errorf("error after stopping: %v", message["message"])
+		case "session_ended":
+			return
+		}
+	}
+}
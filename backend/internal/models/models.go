@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // GadgetType represents the type of gadget
 type GadgetType string
@@ -10,6 +15,12 @@ const (
 	GadgetTraceTCP       GadgetType = "trace_tcp"
 	GadgetSnapshotProc   GadgetType = "snapshot_process"
 	GadgetSnapshotSocket GadgetType = "snapshot_socket"
+	GadgetTraceDNS       GadgetType = "trace_dns"
+	GadgetTraceExec      GadgetType = "trace_exec"
+	GadgetTraceOpen      GadgetType = "trace_open"
+	GadgetTopTCP         GadgetType = "top_tcp"
+	GadgetTopFile        GadgetType = "top_file"
+	GadgetTopBlockIO     GadgetType = "top_block_io"
 )
 
 // GadgetRequest represents a request to run a gadget
@@ -19,6 +30,17 @@ type GadgetRequest struct {
 	PodName   string                 `json:"podName,omitempty"`
 	Container string                 `json:"container,omitempty"`
 	Params    map[string]interface{} `json:"params,omitempty"`
+	// Session lifetime: 0 uses the server default. Pinned sessions run
+	// until explicitly stopped.
+	TimeoutSeconds int  `json:"timeoutSeconds,omitempty"`
+	Pinned         bool `json:"pinned,omitempty"`
+	// What happens when the session's buffers fill: "drop" (default),
+	// "block", "drop-oldest" or "sample" (keep 1 in SampleRate events)
+	OverflowPolicy string `json:"overflowPolicy,omitempty"`
+	SampleRate     int    `json:"sampleRate,omitempty"`
+	// Filter expression evaluated against each event before it is
+	// forwarded or persisted, e.g. `dst.port == 5432 && error != 0`
+	Filter string `json:"filter,omitempty"`
 	// TCP trace specific flags
 	AcceptOnly  bool `json:"acceptOnly,omitempty"`
 	ConnectOnly bool `json:"connectOnly,omitempty"`
@@ -32,11 +54,31 @@ type GadgetSession struct {
 	Namespace   string        `json:"namespace"`
 	PodName     string        `json:"podName,omitempty"`
 	StartTime   time.Time     `json:"startTime"`
-	Status      string        `json:"status"` // "running", "stopped", "error"
+	Status      string        `json:"status"` // "running", "stopped", "error", "imported"
 	Timeout     time.Duration `json:"timeout,omitempty"`
+	Deadline    *time.Time    `json:"deadline,omitempty"` // unset for pinned sessions
+	Pinned      bool          `json:"pinned,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
 	AcceptOnly  bool          `json:"acceptOnly,omitempty"`
 	ConnectOnly bool          `json:"connectOnly,omitempty"`
 	FailureOnly bool          `json:"failureOnly,omitempty"`
+	Owner       string        `json:"owner,omitempty"` // Backend instance running the gadget
+	Reason      string        `json:"reason,omitempty"` // Why a failed session failed
+	// Original request, kept so the session can be restarted on another
+	// backend instance if its owner dies
+	Request  *GadgetRequest   `json:"request,omitempty"`
+	Counters *SessionCounters `json:"counters,omitempty"`
+}
+
+// SessionCounters reports how many events a session received and where any
+// were lost
+type SessionCounters struct {
+	Received      int64 `json:"received"`
+	Filtered      int64 `json:"filtered"`      // Excluded by the session's filter expression
+	Dropped       int64 `json:"dropped"`       // Dropped at the gadget output channel
+	Sampled       int64 `json:"sampled"`       // Skipped by sampling at the gadget output channel
+	ClientDropped int64 `json:"clientDropped"` // Dropped or sampled at WebSocket client send buffers, summed over clients
+	PersistFailed int64 `json:"persistFailed"` // Failed to publish to storage
 }
 
 // GadgetOutput represents output from a gadget
@@ -45,6 +87,51 @@ type GadgetOutput struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Data      map[string]interface{} `json:"data"`
 	EventType string                 `json:"eventType"`
+	// Seq increases monotonically within a session, starting at 1. Clients
+	// resume a stream after the last seq they received.
+	Seq int64 `json:"seq,omitempty"`
+	// Interval (top) gadget specific fields, set on every row of a frame
+	Frame     int64      `json:"frame,omitempty"`
+	FrameTime *time.Time `json:"frameTime,omitempty"`
+}
+
+// EventPage is one page of an event query
+type EventPage struct {
+	Events []GadgetOutput `json:"events"`
+	// NextCursor fetches the following page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// EventCursor is a position in an event query ordered by time, with the
+// session and seq breaking ties between events recorded at the same time
+type EventCursor struct {
+	Time      time.Time `json:"t"`
+	SessionID string    `json:"s"`
+	Seq       int64     `json:"q"`
+}
+
+// CursorAfter returns the cursor positioned at an event
+func CursorAfter(event GadgetOutput) EventCursor {
+	return EventCursor{Time: event.Timestamp, SessionID: event.SessionID, Seq: event.Seq}
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c EventCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseEventCursor decodes a cursor returned by Encode
+func ParseEventCursor(s string) (*EventCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor EventCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Time.IsZero() {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
 }
 
 // TraceSNIEvent represents a trace SNI event
@@ -77,6 +164,109 @@ type TraceTCPEvent struct {
 	Type      string `json:"type"` // "connect", "accept", "close"
 }
 
+// TraceDNSEvent represents a trace dns event
+type TraceDNSEvent struct {
+	Timestamp  string   `json:"timestamp"`
+	Node       string   `json:"node"`
+	Namespace  string   `json:"namespace"`
+	Pod        string   `json:"pod"`
+	Container  string   `json:"container"`
+	Comm       string   `json:"comm"`
+	PID        int32    `json:"pid"`
+	ID         string   `json:"id"`
+	QR         string   `json:"qr"` // "Q" for queries, "R" for responses
+	QType      string   `json:"qtype"`
+	Name       string   `json:"name"`
+	Rcode      string   `json:"rcode,omitempty"`
+	Latency    uint64   `json:"latency,omitempty"` // nanoseconds
+	Addresses  []string `json:"addresses,omitempty"`
+	Nameserver string   `json:"nameserver"`
+}
+
+// TraceExecEvent represents a trace exec event
+type TraceExecEvent struct {
+	Timestamp string   `json:"timestamp"`
+	Node      string   `json:"node"`
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	Comm      string   `json:"comm"`
+	PID       int32    `json:"pid"`
+	PPID      int32    `json:"ppid"`
+	UID       uint32   `json:"uid"`
+	GID       uint32   `json:"gid"`
+	Args      []string `json:"args"`
+	Error     int32    `json:"error"`
+	Cwd       string   `json:"cwd,omitempty"`
+	ExePath   string   `json:"exepath,omitempty"`
+}
+
+// TraceOpenEvent represents a trace open event
+type TraceOpenEvent struct {
+	Timestamp string `json:"timestamp"`
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Comm      string `json:"comm"`
+	PID       int32  `json:"pid"`
+	UID       uint32 `json:"uid"`
+	GID       uint32 `json:"gid"`
+	FName     string `json:"fname"` // opened path, matched by the "path" param
+	Flags     int32  `json:"flags"`
+	Mode      uint32 `json:"mode"`
+	FD        int32  `json:"fd"`
+	Error     int32  `json:"error"`
+}
+
+// TopTCPStats represents a row of top tcp output
+type TopTCPStats struct {
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Comm      string `json:"comm"`
+	PID       int32  `json:"pid"`
+	SrcIP     string `json:"srcIp"`
+	DstIP     string `json:"dstIp"`
+	SrcPort   uint16 `json:"srcPort"`
+	DstPort   uint16 `json:"dstPort"`
+	Sent      uint64 `json:"sent"`
+	Received  uint64 `json:"received"`
+}
+
+// TopFileStats represents a row of top file output
+type TopFileStats struct {
+	Node       string `json:"node"`
+	Namespace  string `json:"namespace"`
+	Pod        string `json:"pod"`
+	Container  string `json:"container"`
+	Comm       string `json:"comm"`
+	PID        int32  `json:"pid"`
+	Filename   string `json:"filename"`
+	FileType   string `json:"fileType"`
+	Reads      uint64 `json:"reads"`
+	Writes     uint64 `json:"writes"`
+	ReadBytes  uint64 `json:"readBytes"`
+	WriteBytes uint64 `json:"writeBytes"`
+}
+
+// TopBlockIOStats represents a row of top block_io output
+type TopBlockIOStats struct {
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Comm      string `json:"comm"`
+	PID       int32  `json:"pid"`
+	Major     int32  `json:"major"`
+	Minor     int32  `json:"minor"`
+	Write     bool   `json:"write"`
+	Bytes     uint64 `json:"bytes"`
+	MicroSecs uint64 `json:"us"`
+	IOs       uint32 `json:"ops"`
+}
+
 // SnapshotProcess represents a process snapshot
 type SnapshotProcess struct {
 	Node      string `json:"node"`
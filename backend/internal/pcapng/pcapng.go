@@ -0,0 +1,134 @@
+// Package pcapng writes packet captures in the pcapng format read by
+// Wireshark and tcpdump, and synthesizes the TCP packets PENNY derives from
+// trace_tcp events.
+//
+// Captures have a single interface carrying raw IPv4/IPv6 packets
+// (LINKTYPE_RAW) with microsecond timestamps. Each packet may carry a
+// comment, which Wireshark shows as pkt_comment.
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	blockSectionHeader  = 0x0A0D0D0A
+	blockInterfaceDesc  = 0x00000001
+	blockEnhancedPacket = 0x00000006
+	byteOrderMagic      = 0x1A2B3C4D
+	linkTypeRaw         = 101
+	optionEnd           = 0
+	optionComment       = 1
+	optionInterfaceName = 2
+	snapLen             = 65535
+	maxCommentLength    = 0xFFFF
+)
+
+// Writer writes a capture. The file header is written with the first
+// packet, or by Close if there are none.
+type Writer struct {
+	w             io.Writer
+	interfaceName string
+	started       bool
+}
+
+// NewWriter creates a capture writer whose interface is named interfaceName
+func NewWriter(w io.Writer, interfaceName string) *Writer {
+	return &Writer{w: w, interfaceName: interfaceName}
+}
+
+// WritePacket appends a packet captured at ts with an optional comment
+func (w *Writer) WritePacket(ts time.Time, packet []byte, comment string) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	micros := uint64(ts.UnixMicro())
+	body := make([]byte, 20, 20+pad4(len(packet))+optionsLength(comment))
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface ID
+	binary.LittleEndian.PutUint32(body[4:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(micros))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(packet))) // captured length
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(packet))) // original length
+	body = appendPadded(body, packet)
+	if comment != "" {
+		body = appendOption(body, optionComment, comment)
+		body = appendOption(body, optionEnd, "")
+	}
+
+	return w.writeBlock(blockEnhancedPacket, body)
+}
+
+// Close writes the file header if no packet has been written. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	return w.start()
+}
+
+// start writes the section header and the interface description
+func (w *Writer) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	section := make([]byte, 16)
+	binary.LittleEndian.PutUint32(section[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(section[4:], 1)          // major version
+	binary.LittleEndian.PutUint16(section[6:], 0)          // minor version
+	binary.LittleEndian.PutUint64(section[8:], ^uint64(0)) // section length unknown
+	if err := w.writeBlock(blockSectionHeader, section); err != nil {
+		return err
+	}
+
+	iface := make([]byte, 8)
+	binary.LittleEndian.PutUint16(iface[0:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(iface[4:], snapLen)
+	if w.interfaceName != "" {
+		iface = appendOption(iface, optionInterfaceName, w.interfaceName)
+		iface = appendOption(iface, optionEnd, "")
+	}
+	return w.writeBlock(blockInterfaceDesc, iface)
+}
+
+// writeBlock frames a block body with its type and lengths
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	length := uint32(12 + len(body))
+	block := make([]byte, 0, length)
+	block = binary.LittleEndian.AppendUint32(block, blockType)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	_, err := w.w.Write(block)
+	return err
+}
+
+// appendOption appends a block option, truncating overly long values
+func appendOption(b []byte, code uint16, value string) []byte {
+	if len(value) > maxCommentLength {
+		value = value[:maxCommentLength]
+	}
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	return appendPadded(b, []byte(value))
+}
+
+// optionsLength is the encoded size of a comment and the end of options
+func optionsLength(comment string) int {
+	if comment == "" {
+		return 0
+	}
+	return 4 + pad4(min(len(comment), maxCommentLength)) + 4
+}
+
+// appendPadded appends data padded with zeros to a 32-bit boundary
+func appendPadded(b, data []byte) []byte {
+	b = append(b, data...)
+	return append(b, make([]byte, pad4(len(data))-len(data))...)
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
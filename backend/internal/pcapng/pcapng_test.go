@@ -0,0 +1,139 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unhex decodes hex with whitespace and "//" comments, one field per line
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	var digits strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		digits.WriteString(strings.Join(strings.Fields(line), ""))
+	}
+	b, err := hex.DecodeString(digits.String())
+	if err != nil {
+		t.Fatalf("invalid hex: %v", err)
+	}
+	return b
+}
+
+// A capture of a single SYN from 10.0.0.1:40000 to 10.0.0.2:443, encoded by
+// hand from the pcapng specification, with the comment "connect"
+const goldenCapture = `
+	0a0d0d0a                 // section header block
+	1c000000                 // block length 28
+	4d3c2b1a                 // byte order magic
+	0100 0000                // version 1.0
+	ffffffffffffffff         // section length unknown
+	1c000000                 // block length 28
+
+	01000000                 // interface description block
+	28000000                 // block length 40
+	6500 0000                // LINKTYPE_RAW, reserved
+	ffff0000                 // snap length 65535
+	0200 0a00                // if_name, 10 bytes
+	70656e6e792d74657374 0000 // "penny-test", padded
+	0000 0000                // opt_endofopt
+	28000000                 // block length 40
+
+	06000000                 // enhanced packet block
+	58000000                 // block length 88
+	00000000                 // interface 0
+	d70d0600 01202110        // 2024-01-01T00:00:00.000001Z in microseconds
+	28000000                 // captured length 40
+	28000000                 // original length 40
+	45000028 00004000 400626ce 0a000001 0a000002 // IPv4 header
+	9c4001bb 00000000 00000000 5002ffff fde40000 // TCP header, SYN
+	0100 0700                // opt_comment, 7 bytes
+	636f6e6e656374 00        // "connect", padded
+	0000 0000                // opt_endofopt
+	58000000                 // block length 88
+`
+
+func TestWriterLayout(t *testing.T) {
+	packet, err := TCPSegment{
+		Src:     net.ParseIP("10.0.0.1"),
+		Dst:     net.ParseIP("10.0.0.2"),
+		SrcPort: 40000,
+		DstPort: 443,
+		Flags:   FlagSYN,
+	}.Packet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "penny-test")
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 1000, time.UTC)
+	if err := w.WritePacket(ts, packet, "connect"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := unhex(t, goldenCapture)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("capture differs from golden\n got: %x\nwant: %x", buf.Bytes(), want)
+	}
+}
+
+func TestWriterEmptyCapture(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, "").Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the section header and an interface description without options
+	want := unhex(t, `
+		0a0d0d0a 1c000000 4d3c2b1a 01000000 ffffffffffffffff 1c000000
+		01000000 14000000 65000000 ffff0000 14000000
+	`)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("empty capture\n got: %x\nwant: %x", buf.Bytes(), want)
+	}
+}
+
+func TestTCPSegmentChecksums(t *testing.T) {
+	for _, segment := range []TCPSegment{
+		{Src: net.ParseIP("10.0.0.1"), Dst: net.ParseIP("10.0.0.2"), SrcPort: 40000, DstPort: 443, Flags: FlagSYN},
+		{Src: net.ParseIP("192.168.1.7"), Dst: net.ParseIP("172.16.0.9"), SrcPort: 5432, DstPort: 51234, Flags: FlagFIN | FlagACK, Ack: 1},
+		{Src: net.ParseIP("fd00::1"), Dst: net.ParseIP("fd00::2"), SrcPort: 8080, DstPort: 33000, Flags: FlagSYN | FlagACK, Ack: 1},
+	} {
+		packet, err := segment.Packet()
+		if err != nil {
+			t.Fatalf("%v -> %v: %v", segment.Src, segment.Dst, err)
+		}
+
+		// A valid checksum makes the covered data sum to all ones
+		var pseudo []byte
+		var tcp []byte
+		if src := segment.Src.To4(); src != nil {
+			if got := checksum(packet[:ipv4HeaderLength], 0); got != 0 {
+				t.Errorf("%v: IPv4 header checksum does not verify", segment.Src)
+			}
+			pseudo = append(append(append([]byte{}, src...), segment.Dst.To4()...), 0, protocolTCP, 0, tcpHeaderLength)
+			tcp = packet[ipv4HeaderLength:]
+		} else {
+			pseudo = append(append([]byte{}, segment.Src.To16()...), segment.Dst.To16()...)
+			pseudo = append(pseudo, 0, 0, 0, tcpHeaderLength, 0, 0, 0, protocolTCP)
+			tcp = packet[ipv6HeaderLength:]
+		}
+		if got := checksum(tcp, sum(pseudo)); got != 0 {
+			t.Errorf("%v: TCP checksum does not verify", segment.Src)
+		}
+	}
+
+	if _, err := (TCPSegment{Src: net.ParseIP("10.0.0.1"), Dst: net.ParseIP("fd00::2")}).Packet(); err == nil {
+		t.Error("mixed address families accepted")
+	}
+}
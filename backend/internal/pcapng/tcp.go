@@ -0,0 +1,121 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// TCP header flags
+const (
+	FlagFIN = 0x01
+	FlagSYN = 0x02
+	FlagRST = 0x04
+	FlagPSH = 0x08
+	FlagACK = 0x10
+)
+
+const (
+	ipv4HeaderLength = 20
+	ipv6HeaderLength = 40
+	tcpHeaderLength  = 20
+	protocolTCP      = 6
+	defaultTTL       = 64
+	defaultWindow    = 65535
+)
+
+// TCPSegment describes a payload-less TCP segment
+type TCPSegment struct {
+	Src, Dst         net.IP
+	SrcPort, DstPort uint16
+	Flags            uint8
+	Seq, Ack         uint32
+}
+
+// Packet encodes the segment as a raw IPv4 or IPv6 packet with valid
+// checksums. Src and Dst must be of the same family.
+func (s TCPSegment) Packet() ([]byte, error) {
+	src4, dst4 := s.Src.To4(), s.Dst.To4()
+	if src4 != nil && dst4 != nil {
+		return s.ipv4(src4, dst4), nil
+	}
+	src16, dst16 := s.Src.To16(), s.Dst.To16()
+	if src4 == nil && dst4 == nil && src16 != nil && dst16 != nil {
+		return s.ipv6(src16, dst16), nil
+	}
+	return nil, fmt.Errorf("invalid or mixed address families: %v -> %v", s.Src, s.Dst)
+}
+
+func (s TCPSegment) ipv4(src, dst net.IP) []byte {
+	packet := make([]byte, ipv4HeaderLength+tcpHeaderLength)
+	ip := packet[:ipv4HeaderLength]
+	ip[0] = 0x45 // version 4, 5 32-bit words
+	binary.BigEndian.PutUint16(ip[2:], uint16(len(packet)))
+	binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+	ip[8] = defaultTTL
+	ip[9] = protocolTCP
+	copy(ip[12:], src)
+	copy(ip[16:], dst)
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip, 0))
+
+	pseudo := make([]byte, 0, 12)
+	pseudo = append(pseudo, src...)
+	pseudo = append(pseudo, dst...)
+	pseudo = append(pseudo, 0, protocolTCP)
+	pseudo = binary.BigEndian.AppendUint16(pseudo, tcpHeaderLength)
+	s.tcp(packet[ipv4HeaderLength:], pseudo)
+	return packet
+}
+
+func (s TCPSegment) ipv6(src, dst net.IP) []byte {
+	packet := make([]byte, ipv6HeaderLength+tcpHeaderLength)
+	ip := packet[:ipv6HeaderLength]
+	ip[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(ip[4:], tcpHeaderLength)
+	ip[6] = protocolTCP
+	ip[7] = defaultTTL
+	copy(ip[8:], src)
+	copy(ip[24:], dst)
+
+	pseudo := make([]byte, 0, 40)
+	pseudo = append(pseudo, src...)
+	pseudo = append(pseudo, dst...)
+	pseudo = binary.BigEndian.AppendUint32(pseudo, tcpHeaderLength)
+	pseudo = append(pseudo, 0, 0, 0, protocolTCP)
+	s.tcp(packet[ipv6HeaderLength:], pseudo)
+	return packet
+}
+
+// tcp fills in the TCP header, checksummed over the IP pseudo-header
+func (s TCPSegment) tcp(header, pseudo []byte) {
+	binary.BigEndian.PutUint16(header[0:], s.SrcPort)
+	binary.BigEndian.PutUint16(header[2:], s.DstPort)
+	binary.BigEndian.PutUint32(header[4:], s.Seq)
+	binary.BigEndian.PutUint32(header[8:], s.Ack)
+	header[12] = (tcpHeaderLength / 4) << 4
+	header[13] = s.Flags
+	binary.BigEndian.PutUint16(header[14:], defaultWindow)
+	binary.BigEndian.PutUint16(header[16:], checksum(header, sum(pseudo)))
+}
+
+// checksum returns the internet checksum of data, continuing from a
+// partial sum
+func checksum(data []byte, initial uint32) uint16 {
+	total := initial + sum(data)
+	for total > 0xFFFF {
+		total = (total >> 16) + (total & 0xFFFF)
+	}
+	return ^uint16(total)
+}
+
+// sum adds data as big-endian 16-bit words
+func sum(data []byte) uint32 {
+	var total uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		total += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		total += uint32(data[len(data)-1]) << 8
+	}
+	return total
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"inspector-gadget-management/backend/internal/models"
@@ -20,6 +21,7 @@ const (
 	backendHeartbeatKey  = "backend:%s:heartbeat"
 	wsConnectionKey      = "ws:%s"
 	lockKeyPrefix        = "lock:session:"
+	outputChannelPrefix  = "output:"
 
 	// Lock settings
 	lockTimeout      = 10 * time.Second
@@ -29,6 +31,9 @@ const (
 	// Heartbeat settings
 	heartbeatInterval = 5 * time.Second
 	heartbeatTimeout  = 15 * time.Second
+
+	// How long a failed session is kept so clients can see why it failed
+	failedSessionTTL = time.Hour
 )
 
 // SessionStore handles distributed session management with Redis
@@ -86,6 +91,9 @@ func (s *SessionStore) CreateSession(session models.GadgetSession) error {
 	}
 	defer s.releaseLock(lockKey)
 
+	// Record which backend runs the gadget so other replicas can relay it
+	session.Owner = s.instanceID
+
 	// Serialize session
 	sessionData, err := json.Marshal(session)
 	if err != nil {
@@ -131,7 +139,9 @@ func (s *SessionStore) GetSession(sessionID string) (*models.GadgetSession, erro
 	return &session, nil
 }
 
-// UpdateSession updates a session in Redis
+// UpdateSession updates an existing session in Redis. Only the session's
+// owner may update it, so an instance that lost a session to failover can't
+// overwrite the new owner's state.
 func (s *SessionStore) UpdateSession(session models.GadgetSession) error {
 	lockKey := lockKeyPrefix + session.ID
 	if err := s.acquireLock(lockKey); err != nil {
@@ -139,13 +149,29 @@ func (s *SessionStore) UpdateSession(session models.GadgetSession) error {
 	}
 	defer s.releaseLock(lockKey)
 
+	current, err := s.GetSession(session.ID)
+	if err != nil {
+		return err
+	}
+	if current.Owner != s.instanceID {
+		return fmt.Errorf("session %s is owned by backend instance %s", session.ID, current.Owner)
+	}
+
+	session.Owner = s.instanceID
+
 	sessionData, err := json.Marshal(session)
 	if err != nil {
 		return fmt.Errorf("failed to marshal session: %w", err)
 	}
 
+	// Only overwrite existing sessions, so a late update racing with
+	// DeleteSession can't bring a session back, and keep the expiry of
+	// failed sessions
 	sessionKey := sessionKeyPrefix + session.ID
-	if err := s.redis.Set(s.ctx, sessionKey, sessionData, 0).Err(); err != nil {
+	err = s.redis.SetArgs(s.ctx, sessionKey, sessionData, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return fmt.Errorf("session not found: %s", session.ID)
+	} else if err != nil {
 		return fmt.Errorf("failed to update session: %w", err)
 	}
 
@@ -236,6 +262,61 @@ func (s *SessionStore) HasWebSocket(sessionID string) bool {
 	return instanceID == s.instanceID
 }
 
+// PublishOutput publishes a message from a session's output pipeline to the
+// replicas relaying it to their WebSocket clients
+func (s *SessionStore) PublishOutput(sessionID string, data []byte) error {
+	return s.redis.Publish(s.ctx, outputChannelPrefix+sessionID, data).Err()
+}
+
+// OutputSubscribers returns how many replicas are subscribed to a session's
+// output
+func (s *SessionStore) OutputSubscribers(sessionID string) (int64, error) {
+	channel := outputChannelPrefix + sessionID
+	counts, err := s.redis.PubSubNumSub(s.ctx, channel).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count output subscribers: %w", err)
+	}
+	return counts[channel], nil
+}
+
+// SubscribeOutput subscribes to the output published by the backend that owns
+// a session. The returned channel is closed once ctx is done.
+func (s *SessionStore) SubscribeOutput(ctx context.Context, sessionID string) (<-chan []byte, error) {
+	pubsub := s.redis.Subscribe(ctx, outputChannelPrefix+sessionID)
+
+	// Wait for the subscription to be confirmed so no output is missed
+	// between returning and the first receive
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to session output: %w", err)
+	}
+
+	messages := make(chan []byte, 256)
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
 // acquireLock acquires a distributed lock for a session
 func (s *SessionStore) acquireLock(lockKey string) error {
 	lockValue := s.instanceID + ":" + time.Now().String()
@@ -267,46 +348,174 @@ func (s *SessionStore) sendHeartbeats() {
 	ticker := time.NewTicker(heartbeatInterval)
 	defer ticker.Stop()
 
+	heartbeatKey := fmt.Sprintf(backendHeartbeatKey, s.instanceID)
+
+	// Send the first heartbeat right away so other replicas don't consider
+	// this one dead while it starts up
+	s.redis.Set(s.ctx, heartbeatKey, time.Now().Unix(), heartbeatTimeout)
+
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
 		case <-ticker.C:
-			heartbeatKey := fmt.Sprintf(backendHeartbeatKey, s.instanceID)
 			s.redis.Set(s.ctx, heartbeatKey, time.Now().Unix(), heartbeatTimeout)
 		}
 	}
 }
 
-// RecoverSessions attempts to recover sessions from a failed backend instance
-func (s *SessionStore) RecoverSessions() error {
-	// Get all backend instances
-	pattern := fmt.Sprintf(backendHeartbeatKey, "*")
-	keys, err := s.redis.Keys(s.ctx, pattern).Result()
+// RecoverSessions returns the active sessions whose owning backend instance
+// is dead. A backend is dead once its heartbeat key has expired. Index entries
+// for sessions whose data no longer exists are removed.
+//
+// Sessions created before owners were recorded have none; their backend is
+// the one whose session set lists them, and they are orphaned once its
+// heartbeat has expired or no backend lists them any more.
+func (s *SessionStore) RecoverSessions() ([]models.GadgetSession, error) {
+	sessionIDs, err := s.redis.SMembers(s.ctx, sessionIndexKey).Result()
 	if err != nil {
-		return fmt.Errorf("failed to list backend instances: %w", err)
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
 
-	now := time.Now().Unix()
+	alive := map[string]bool{s.instanceID: true}
+	var orphaned []models.GadgetSession
+	var legacyOwners map[string]string // session ID -> backend, read once
 
-	// Check each backend's heartbeat
-	for _, key := range keys {
-		lastHeartbeat, err := s.redis.Get(s.ctx, key).Int64()
-		if err == redis.Nil {
-			continue
-		} else if err != nil {
+	for _, sessionID := range sessionIDs {
+		session, err := s.GetSession(sessionID)
+		if err != nil {
+			exists, existsErr := s.redis.Exists(s.ctx, sessionKeyPrefix+sessionID).Result()
+			if existsErr == nil && exists == 0 {
+				// Ghost index entry left behind by a backend that died
+				// while deleting the session
+				s.redis.SRem(s.ctx, sessionIndexKey, sessionID)
+			}
 			continue
 		}
 
-		// If heartbeat is too old, backend is dead
-		if now-lastHeartbeat > int64(heartbeatTimeout.Seconds()) {
-			// Extract instance ID from key
-			// TODO: Mark sessions from dead backend as failed
-			// This would require reconnecting to gadget-daemon
-			// For now, we'll just log it
-			fmt.Printf("Detected dead backend instance: %s\n", key)
+		owner := session.Owner
+		if owner == "" {
+			if legacyOwners == nil {
+				if legacyOwners, err = s.sessionBackends(); err != nil {
+					return nil, err
+				}
+			}
+			owner = legacyOwners[session.ID]
+		}
+
+		ownerAlive, checked := alive[owner]
+		if !checked && owner != "" {
+			heartbeatKey := fmt.Sprintf(backendHeartbeatKey, owner)
+			exists, err := s.redis.Exists(s.ctx, heartbeatKey).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to check backend heartbeat: %w", err)
+			}
+			ownerAlive = exists > 0
+			alive[owner] = ownerAlive
+		}
+
+		if !ownerAlive {
+			orphaned = append(orphaned, *session)
+		}
+	}
+
+	return orphaned, nil
+}
+
+// sessionBackends maps session IDs to the backend instances whose session
+// sets list them
+func (s *SessionStore) sessionBackends() (map[string]string, error) {
+	backends := make(map[string]string)
+	prefix, suffix, _ := strings.Cut(backendSessionsKey, "%s")
+
+	iter := s.redis.Scan(s.ctx, 0, fmt.Sprintf(backendSessionsKey, "*"), 100).Iterator()
+	for iter.Next(s.ctx) {
+		key := iter.Val()
+		instanceID := strings.TrimSuffix(strings.TrimPrefix(key, prefix), suffix)
+		sessionIDs, err := s.redis.SMembers(s.ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backend sessions: %w", err)
+		}
+		for _, sessionID := range sessionIDs {
+			backends[sessionID] = instanceID
 		}
 	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list backends: %w", err)
+	}
+	return backends, nil
+}
+
+// ClaimSession makes this backend instance the owner of an orphaned session.
+// It returns false if the session no longer exists or was already claimed by
+// another instance since it was read.
+func (s *SessionStore) ClaimSession(session models.GadgetSession) (bool, error) {
+	lockKey := lockKeyPrefix + session.ID
+	if err := s.acquireLock(lockKey); err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer s.releaseLock(lockKey)
+
+	current, err := s.GetSession(session.ID)
+	if err != nil || current.Owner != session.Owner {
+		return false, nil
+	}
+
+	previousOwner := current.Owner
+	current.Owner = s.instanceID
+
+	sessionData, err := json.Marshal(current)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	pipe := s.redis.Pipeline()
+	pipe.Set(s.ctx, sessionKeyPrefix+session.ID, sessionData, 0)
+	if previousOwner != "" {
+		pipe.SRem(s.ctx, fmt.Sprintf(backendSessionsKey, previousOwner), session.ID)
+	}
+	pipe.SAdd(s.ctx, fmt.Sprintf(backendSessionsKey, s.instanceID), session.ID)
+
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return false, fmt.Errorf("failed to claim session: %w", err)
+	}
+
+	return true, nil
+}
+
+// FailSession marks a session as failed and removes it from the active
+// sessions. The session data is kept for a while so clients can see the reason.
+func (s *SessionStore) FailSession(sessionID string, reason string) error {
+	lockKey := lockKeyPrefix + sessionID
+	if err := s.acquireLock(lockKey); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer s.releaseLock(lockKey)
+
+	session, err := s.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.Status = "failed"
+	session.Reason = reason
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	pipe := s.redis.Pipeline()
+	pipe.Set(s.ctx, sessionKeyPrefix+sessionID, sessionData, failedSessionTTL)
+	pipe.SRem(s.ctx, sessionIndexKey, sessionID)
+	if session.Owner != "" {
+		pipe.SRem(s.ctx, fmt.Sprintf(backendSessionsKey, session.Owner), sessionID)
+	}
+	pipe.Del(s.ctx, fmt.Sprintf(wsConnectionKey, sessionID))
+
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return fmt.Errorf("failed to mark session failed: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// migrationLock names the advisory lock replicas take while migrating
+	migrationLock = "penny:schema-migrations"
+	// migrationTimeout bounds how long a replica waits for the lock and
+	// applies migrations
+	migrationTimeout = 5 * time.Minute
+)
+
+// migration is one versioned step of the TimescaleDB schema. Applied
+// migrations must never change; schema changes are appended as new ones.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// migrations lists the schema in the order it is applied. The first one is
+// idempotent so that databases set up before migrations existed are adopted.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create events and sessions tables",
+		statements: []string{
+			`CREATE EXTENSION IF NOT EXISTS timescaledb`,
+			`CREATE TABLE IF NOT EXISTS gadget_events (
+				time TIMESTAMPTZ NOT NULL,
+				session_id TEXT NOT NULL,
+				event_type TEXT NOT NULL,
+				namespace TEXT,
+				pod_name TEXT,
+				data JSONB NOT NULL,
+				frame BIGINT,
+				seq BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`ALTER TABLE gadget_events ADD COLUMN IF NOT EXISTS frame BIGINT`,
+			`ALTER TABLE gadget_events ADD COLUMN IF NOT EXISTS seq BIGINT`,
+			`SELECT create_hypertable('gadget_events', 'time', if_not_exists => TRUE)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_session_id ON gadget_events (session_id, time DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_type_time ON gadget_events (event_type, time DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_namespace ON gadget_events (namespace, time DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_data ON gadget_events USING GIN (data)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_session_frame ON gadget_events (session_id, frame) WHERE frame IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_events_session_seq ON gadget_events (session_id, seq) WHERE seq IS NOT NULL`,
+			`CREATE TABLE IF NOT EXISTS gadget_sessions (
+				id TEXT PRIMARY KEY,
+				type TEXT NOT NULL,
+				namespace TEXT,
+				pod_name TEXT,
+				status TEXT NOT NULL,
+				start_time TIMESTAMPTZ NOT NULL,
+				end_time TIMESTAMPTZ,
+				reason TEXT,
+				event_count BIGINT DEFAULT 0,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`ALTER TABLE gadget_sessions ADD COLUMN IF NOT EXISTS reason TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_start_time ON gadget_sessions (start_time DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_type ON gadget_sessions (type)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "compress event chunks older than a week",
+		statements: []string{
+			// Compression isn't available in Apache-licensed TimescaleDB builds
+			`DO $$
+			BEGIN
+				IF current_setting('timescaledb.license', true) IS DISTINCT FROM 'apache' THEN
+					ALTER TABLE gadget_events SET (
+						timescaledb.compress,
+						timescaledb.compress_segmentby = 'session_id',
+						timescaledb.compress_orderby = 'time DESC'
+					);
+					PERFORM add_compression_policy('gadget_events', INTERVAL '7 days', if_not_exists => TRUE);
+				END IF;
+			END
+			$$`,
+		},
+	},
+}
+
+// migrate brings the schema up to the latest migration and applies the
+// retention policy. Replicas starting together serialize on an advisory
+// lock, so each migration runs once; applied versions are recorded in
+// schema_migrations.
+func migrate(ctx context.Context, db *pgxpool.Pool, retention time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	// Advisory locks belong to a connection, so everything runs on one
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock(hashtext($1))`, migrationLock); err != nil {
+		return fmt.Errorf("failed to lock schema migrations: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock(hashtext($1))`, migrationLock)
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		// Rolled back to an older backend; newer migrations stay in place
+		log.Printf("Warning: schema version %d is newer than this backend's %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("migration %d: failed to begin transaction: %w", m.version, err)
+		}
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(ctx, statement); err != nil {
+				tx.Rollback(ctx)
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("migration %d: failed to record version: %w", m.version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("migration %d: failed to commit: %w", m.version, err)
+		}
+		log.Printf("Applied schema migration %d: %s", m.version, m.name)
+	}
+
+	if retention > 0 {
+		return setRetention(ctx, conn.Conn(), retention)
+	}
+	return nil
+}
+
+// setRetention replaces the retention policy of stored events. Like
+// compression, retention policies aren't available in Apache-licensed
+// TimescaleDB builds, where events are kept.
+func setRetention(ctx context.Context, conn *pgx.Conn, retention time.Duration) error {
+	var license *string
+	if err := conn.QueryRow(ctx, `SELECT current_setting('timescaledb.license', true)`).Scan(&license); err != nil {
+		return fmt.Errorf("failed to read TimescaleDB license: %w", err)
+	}
+	if license != nil && *license == "apache" {
+		log.Printf("Warning: ignoring event retention of %v, not supported by Apache-licensed TimescaleDB", retention)
+		return nil
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin retention policy update: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT remove_retention_policy('gadget_events', if_exists => TRUE)`); err != nil {
+		return fmt.Errorf("failed to replace retention policy: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `SELECT add_retention_policy('gadget_events', make_interval(secs => $1))`, retention.Seconds()); err != nil {
+		return fmt.Errorf("failed to add retention policy: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit retention policy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DeadLetter is an event that could not be stored
+type DeadLetter struct {
+	ID         string    `json:"id"`         // Entry in the dead-letter stream
+	OriginalID string    `json:"originalId"` // Entry in the events stream
+	SessionID  string    `json:"sessionId"`
+	EventType  string    `json:"eventType"`
+	Timestamp  string    `json:"timestamp"`
+	Deliveries int64     `json:"deliveries"`
+	Reason     string    `json:"reason"`
+	FailedAt   time.Time `json:"failedAt"`
+}
+
+// maintainStream periodically retries events that were delivered to the
+// consumer group but never acknowledged, because writing them failed or
+// their consumer died. Events delivered MaxDeliveries times are moved to the
+// dead-letter stream instead. Consumers of replicas that have gone away are
+// removed from the group once their events have been claimed, and stored
+// events are trimmed from the stream.
+func (s *Storage) maintainStream(ctx context.Context) {
+	ticker := time.NewTicker(claimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.claimPending(ctx); err != nil {
+				log.Printf("Error recovering pending events: %v", err)
+			}
+			if err := s.removeStaleConsumers(ctx); err != nil {
+				log.Printf("Error removing stale consumers: %v", err)
+			}
+			if err := s.trimStream(ctx); err != nil {
+				log.Printf("Error trimming event stream: %v", err)
+			}
+		}
+	}
+}
+
+// claimPending retries the idle pending events, claimBatch at a time,
+// until none are left. Claiming resets an event's idle time, so events that
+// fail again are not listed again until a later pass.
+func (s *Storage) claimPending(ctx context.Context) error {
+	// Retrying while the database is down would only use up deliveries
+	if err := s.db.Ping(ctx); err != nil {
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+
+	for {
+		listed, err := s.retryPending(ctx)
+		if err != nil || listed == 0 {
+			return err
+		}
+	}
+}
+
+// retryPending claims up to claimBatch idle pending events and writes them
+// again. It returns how many pending events were listed.
+func (s *Storage) retryPending(ctx context.Context) (int, error) {
+	pending, err := s.redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: EventsStreamName,
+		Group:  ConsumerGroup,
+		Idle:   claimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  claimBatch,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending events: %w", err)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	retry := make([]string, 0, len(pending))
+	deliveries := make(map[string]int64, len(pending))
+	for _, entry := range pending {
+		deliveries[entry.ID] = entry.RetryCount
+		retry = append(retry, entry.ID)
+	}
+
+	// Claiming counts as another delivery
+	messages, err := s.redis.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   EventsStreamName,
+		Group:    ConsumerGroup,
+		Consumer: s.consumerName,
+		MinIdle:  claimIdle,
+		Messages: retry,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim pending events: %w", err)
+	}
+
+	var events []batchEvent
+	for _, message := range messages {
+		if deliveries[message.ID] >= s.maxDeliveries {
+			s.deadLetter(ctx, message, deliveries[message.ID],
+				fmt.Sprintf("not stored after %d deliveries", deliveries[message.ID]))
+			continue
+		}
+		row, err := messageRow(message)
+		if err != nil {
+			s.deadLetter(ctx, message, deliveries[message.ID]+1, err.Error())
+			continue
+		}
+		events = append(events, batchEvent{message: message, row: row, deliveries: deliveries[message.ID] + 1})
+	}
+	if len(events) == 0 {
+		return len(pending), nil
+	}
+
+	// Some of them may have been stored before their ack failed, and COPY
+	// would store those twice
+	stored, err := s.storedEvents(ctx, events)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	var unstored []batchEvent
+	for i, event := range events {
+		if stored[i] {
+			ids = append(ids, event.message.ID)
+		} else {
+			unstored = append(unstored, event)
+		}
+	}
+	if len(ids) > 0 {
+		if err := s.redis.XAck(ctx, EventsStreamName, ConsumerGroup, ids...).Err(); err != nil {
+			return 0, fmt.Errorf("failed to acknowledge events: %w", err)
+		}
+	}
+
+	log.Printf("Retrying %d pending events (%d already stored)", len(events), len(ids))
+	if len(unstored) > 0 {
+		if err := s.writeBatch(ctx, unstored); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+// storedEventsQuery returns the ordinals of the events, given as arrays of
+// their time, session and sequence number, that are already stored
+const storedEventsQuery = `
+	SELECT c.i
+	FROM unnest($1::timestamptz[], $2::text[], $3::bigint[]) WITH ORDINALITY AS c(time, session_id, seq, i)
+	WHERE EXISTS (
+		SELECT 1 FROM gadget_events e
+		WHERE e.session_id = c.session_id AND e.seq = c.seq AND e.time = c.time
+	)
+`
+
+// storedEvents reports which events are already stored, by their index.
+// Events without a sequence number can't be told apart from others of
+// their session and are never reported.
+func (s *Storage) storedEvents(ctx context.Context, events []batchEvent) (map[int]bool, error) {
+	var indexes []int
+	var times []time.Time
+	var sessions []string
+	var seqs []int64
+	for i, event := range events {
+		seq, _ := event.row[7].(*int64)
+		if seq == nil {
+			continue
+		}
+		indexes = append(indexes, i)
+		times = append(times, event.row[0].(time.Time))
+		sessions = append(sessions, event.row[1].(string))
+		seqs = append(seqs, *seq)
+	}
+
+	stored := make(map[int]bool)
+	if len(indexes) == 0 {
+		return stored, nil
+	}
+
+	rows, err := s.db.Query(ctx, storedEventsQuery, times, sessions, seqs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up stored events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ordinal int64
+		if err := rows.Scan(&ordinal); err != nil {
+			return nil, fmt.Errorf("failed to scan stored event: %w", err)
+		}
+		stored[indexes[ordinal-1]] = true
+	}
+	return stored, rows.Err()
+}
+
+// removeStaleConsumers deletes consumers that haven't read from the stream
+// for staleConsumerIdle and have nothing pending. Live consumers read at
+// least every few seconds, even when the stream is quiet.
+func (s *Storage) removeStaleConsumers(ctx context.Context) error {
+	consumers, err := s.redis.XInfoConsumers(ctx, EventsStreamName, ConsumerGroup).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list consumers: %w", err)
+	}
+
+	for _, consumer := range consumers {
+		if consumer.Name == s.consumerName || consumer.Pending > 0 || consumer.Idle < staleConsumerIdle {
+			continue
+		}
+		if err := s.redis.XGroupDelConsumer(ctx, EventsStreamName, ConsumerGroup, consumer.Name).Err(); err != nil {
+			return fmt.Errorf("failed to remove consumer %s: %w", consumer.Name, err)
+		}
+		log.Printf("Removed stale consumer %s (idle for %v)", consumer.Name, consumer.Idle.Round(time.Second))
+	}
+	return nil
+}
+
+// deadLetter moves an event to the dead-letter stream and acknowledges it
+func (s *Storage) deadLetter(ctx context.Context, message redis.XMessage, deliveries int64, reason string) {
+	values := make(map[string]interface{}, len(message.Values)+4)
+	for key, value := range message.Values {
+		values[key] = value
+	}
+	values["original_id"] = message.ID
+	values["deliveries"] = deliveries
+	values["reason"] = reason
+	values["failed_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if err := s.redis.XAdd(ctx, &redis.XAddArgs{Stream: DeadLetterStreamName, Values: values}).Err(); err != nil {
+		// Leave it pending so it is dead-lettered on a later pass
+		log.Printf("Failed to dead-letter event %s: %v", message.ID, err)
+		return
+	}
+	s.redis.XAck(ctx, EventsStreamName, ConsumerGroup, message.ID)
+	log.Printf("Dead-lettered event %s: %s", message.ID, reason)
+}
+
+// ListDeadLetters returns up to limit dead-lettered events, oldest first
+func (s *Storage) ListDeadLetters(ctx context.Context, limit int) (interface{}, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	messages, err := s.redis.XRangeN(ctx, DeadLetterStreamName, "-", "+", int64(limit)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+
+	letters := make([]DeadLetter, 0, len(messages))
+	for _, message := range messages {
+		letter := DeadLetter{ID: message.ID}
+		letter.OriginalID, _ = message.Values["original_id"].(string)
+		letter.SessionID, _ = message.Values["session_id"].(string)
+		letter.EventType, _ = message.Values["event_type"].(string)
+		letter.Timestamp, _ = message.Values["timestamp"].(string)
+		letter.Reason, _ = message.Values["reason"].(string)
+		if deliveries, ok := message.Values["deliveries"].(string); ok {
+			letter.Deliveries, _ = strconv.ParseInt(deliveries, 10, 64)
+		}
+		if failedAt, ok := message.Values["failed_at"].(string); ok {
+			letter.FailedAt, _ = time.Parse(time.RFC3339Nano, failedAt)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters publishes dead-lettered events to the events stream
+// again and removes them from the dead-letter stream. With no ids, all of
+// them are replayed. It returns the number of events replayed.
+func (s *Storage) ReplayDeadLetters(ctx context.Context, ids []string) (int, error) {
+	var messages []redis.XMessage
+	if len(ids) == 0 {
+		var err error
+		if messages, err = s.redis.XRange(ctx, DeadLetterStreamName, "-", "+").Result(); err != nil {
+			return 0, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+	} else {
+		for _, id := range ids {
+			found, err := s.redis.XRange(ctx, DeadLetterStreamName, id, id).Result()
+			if err != nil {
+				return 0, fmt.Errorf("failed to read dead letter %s: %w", id, err)
+			}
+			messages = append(messages, found...)
+		}
+	}
+
+	replayed := 0
+	for _, message := range messages {
+		values := make(map[string]interface{}, len(message.Values))
+		for key, value := range message.Values {
+			switch key {
+			case "original_id", "deliveries", "reason", "failed_at":
+			default:
+				values[key] = value
+			}
+		}
+
+		if err := s.redis.XAdd(ctx, &redis.XAddArgs{Stream: EventsStreamName, Values: values}).Err(); err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter %s: %w", message.ID, err)
+		}
+		if err := s.redis.XDel(ctx, DeadLetterStreamName, message.ID).Err(); err != nil {
+			return replayed, fmt.Errorf("failed to remove dead letter %s: %w", message.ID, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
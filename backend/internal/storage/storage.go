@@ -3,12 +3,19 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"strings"
 	"time"
 
+	"inspector-gadget-management/backend/internal/filter"
 	"inspector-gadget-management/backend/internal/models"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
@@ -18,15 +25,63 @@ const (
 	EventsStreamName = "gadget:events"
 	// Consumer group name
 	ConsumerGroup = "gadget-processors"
-	// Consumer name
-	ConsumerName = "processor-1"
+
+	// MaxBackfillEvents bounds how many missed events EventsSince returns
+	MaxBackfillEvents = 10000
+	// maxStreamScan bounds how many stream entries are scanned for a
+	// session's recent events before falling back to TimescaleDB
+	maxStreamScan = 10000
+	streamScanBatch = 500
+
+	// DefaultPageSize and MaxPageSize bound the events QueryEvents returns
+	// per page
+	DefaultPageSize = 1000
+	MaxPageSize     = 10000
+
+	// importBatchSize is how many imported events are copied at a time
+	importBatchSize = 1000
+
+	// DefaultBatchSize and DefaultFlushInterval bound how many events the
+	// consumer accumulates, and for how long, before writing them
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = time.Second
+	// MaxFlushInterval keeps batches from waiting long enough for their
+	// events to be claimed as idle and written a second time
+	MaxFlushInterval = claimIdle / 2
+	// consumerBlock is how long the consumer waits for events when it has
+	// nothing to flush
+	consumerBlock = 5 * time.Second
+
+	// DeadLetterStreamName holds events that could not be stored
+	DeadLetterStreamName = "gadget:events:dead"
+	// DefaultMaxDeliveries is how often an event is delivered to the
+	// consumer before it is dead-lettered
+	DefaultMaxDeliveries = 5
+	// claimIdle is how long an event stays pending before it is retried,
+	// and claimInterval how often pending events are checked
+	claimIdle     = 30 * time.Second
+	claimInterval = 15 * time.Second
+	claimBatch    = 100
+	// staleConsumerIdle is how long a consumer must not have read from the
+	// stream before it is considered gone
+	staleConsumerIdle = 10 * time.Minute
+
+	// DefaultStreamMaxLen is roughly how many events the stream keeps once
+	// they have been stored
+	DefaultStreamMaxLen = 100000
 )
 
 // Storage handles data persistence for gadget events
 type Storage struct {
-	redis *redis.Client
-	db    *pgxpool.Pool
-	ctx   context.Context
+	redis         *redis.Client
+	db            *pgxpool.Pool
+	ctx           context.Context
+	batchSize     int
+	flushInterval time.Duration
+	maxDeliveries int64
+	consumerName  string
+	streamMaxLen  int64
+	streamMaxAge  time.Duration
 }
 
 // Config holds storage configuration
@@ -34,6 +89,25 @@ type Config struct {
 	RedisAddr    string
 	RedisPass    string
 	PostgresURL  string
+	// BatchSize and FlushInterval bound the consumer's batches, see
+	// StartConsumer. Zero selects the defaults; FlushInterval is capped at
+	// MaxFlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxDeliveries bounds how often a failing event is retried before it
+	// is moved to the dead-letter stream. Zero selects the default.
+	MaxDeliveries int
+	// ConsumerName identifies this replica in the consumer group and must
+	// be unique per replica. Empty selects the hostname.
+	ConsumerName string
+	// StreamMaxLen and StreamMaxAge bound how many stored events the
+	// stream keeps, and for how long. Zero StreamMaxLen selects the
+	// default, zero StreamMaxAge keeps events regardless of age.
+	StreamMaxLen  int64
+	StreamMaxAge  time.Duration
+	// EventRetention replaces the retention policy of stored events when
+	// set. Zero leaves the current policy in place.
+	EventRetention time.Duration
 }
 
 // NewStorage creates a new storage instance
@@ -47,6 +121,7 @@ func NewStorage(ctx context.Context, cfg Config) (*Storage, error) {
 
 	// Test Redis connection
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
@@ -55,16 +130,26 @@ func NewStorage(ctx context.Context, cfg Config) (*Storage, error) {
 	// Initialize PostgreSQL connection pool
 	dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
 	if err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
 
 	// Test database connection
 	if err := dbPool.Ping(ctx); err != nil {
+		dbPool.Close()
+		rdb.Close()
 		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
 	}
 
 	log.Printf("Connected to PostgreSQL")
 
+	// Bring the schema up to date before anything reads or writes events
+	if err := migrate(ctx, dbPool, cfg.EventRetention); err != nil {
+		dbPool.Close()
+		rdb.Close()
+		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+
 	// Create consumer group if it doesn't exist
 	// MKSTREAM creates the stream if it doesn't exist
 	err = rdb.XGroupCreateMkStream(ctx, EventsStreamName, ConsumerGroup, "0").Err()
@@ -72,14 +157,51 @@ func NewStorage(ctx context.Context, cfg Config) (*Storage, error) {
 		log.Printf("Warning: Failed to create consumer group: %v", err)
 	}
 
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	if flushInterval > MaxFlushInterval {
+		log.Printf("Warning: flush interval %v capped at %v", flushInterval, MaxFlushInterval)
+		flushInterval = MaxFlushInterval
+	}
+	maxDeliveries := cfg.MaxDeliveries
+	if maxDeliveries <= 0 {
+		maxDeliveries = DefaultMaxDeliveries
+	}
+	streamMaxLen := cfg.StreamMaxLen
+	if streamMaxLen <= 0 {
+		streamMaxLen = DefaultStreamMaxLen
+	}
+	consumerName := cfg.ConsumerName
+	if consumerName == "" {
+		if consumerName, err = os.Hostname(); err != nil {
+			dbPool.Close()
+			rdb.Close()
+			return nil, fmt.Errorf("failed to name consumer: %w", err)
+		}
+	}
+
 	return &Storage{
-		redis: rdb,
-		db:    dbPool,
-		ctx:   ctx,
+		redis:         rdb,
+		db:            dbPool,
+		ctx:           ctx,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		maxDeliveries: int64(maxDeliveries),
+		consumerName:  consumerName,
+		streamMaxLen:  streamMaxLen,
+		streamMaxAge:  cfg.StreamMaxAge,
 	}, nil
 }
 
-// PublishEvent publishes a gadget event to Redis Streams
+// PublishEvent publishes a gadget event to Redis Streams. The stream isn't
+// capped here, as MAXLEN could drop events before they are stored; the
+// consumer trims stored events instead, see trimStream.
 func (s *Storage) PublishEvent(event models.GadgetOutput) error {
 	// Serialize event data
 	eventData, err := json.Marshal(event)
@@ -92,6 +214,7 @@ func (s *Storage) PublishEvent(event models.GadgetOutput) error {
 		"session_id": event.SessionID,
 		"event_type": event.EventType,
 		"timestamp":  event.Timestamp.Format(time.RFC3339Nano),
+		"seq":        event.Seq,
 		"data":       string(eventData),
 	}
 
@@ -107,53 +230,176 @@ func (s *Storage) PublishEvent(event models.GadgetOutput) error {
 	return nil
 }
 
-// StartConsumer starts consuming events from Redis Streams and writes to TimescaleDB
+// StartConsumer starts consuming events from Redis Streams and writes to
+// TimescaleDB. Events are accumulated until the batch size is reached or the
+// flush interval has passed since the first of them, then written with a
+// single COPY and acknowledged with a single XACK. Events left pending by a
+// failed write are retried, see maintainStream.
 func (s *Storage) StartConsumer(ctx context.Context) error {
-	log.Printf("Starting event consumer...")
+	log.Printf("Starting event consumer %s (batches of up to %d events every %v)...", s.consumerName, s.batchSize, s.flushInterval)
+
+	go s.maintainStream(ctx)
+
+	var (
+		batch    []batchEvent
+		deadline time.Time
+	)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.writeBatch(ctx, batch); err != nil {
+			// Left pending in the consumer group
+			log.Printf("Error writing batch of %d events: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			// Write what was already read rather than leaving it pending
+			flush(context.WithoutCancel(ctx))
 			log.Printf("Consumer stopped")
 			return ctx.Err()
 		default:
-			// Read from stream
-			streams, err := s.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
-				Group:    ConsumerGroup,
-				Consumer: ConsumerName,
-				Streams:  []string{EventsStreamName, ">"},
-				Count:    10,
-				Block:    5 * time.Second,
-			}).Result()
-
-			if err != nil {
-				if err == redis.Nil {
-					// No new messages
-					continue
-				}
-				log.Printf("Error reading from stream: %v", err)
-				time.Sleep(1 * time.Second)
+		}
+
+		// Wait for events until the pending batch is due
+		block := consumerBlock
+		if len(batch) > 0 {
+			block = time.Until(deadline)
+			if block < time.Millisecond {
+				flush(ctx)
 				continue
 			}
+		}
+
+		streams, err := s.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    ConsumerGroup,
+			Consumer: s.consumerName,
+			Streams:  []string{EventsStreamName, ">"},
+			Count:    int64(s.batchSize - len(batch)),
+			Block:    block,
+		}).Result()
 
-			// Process messages
-			for _, stream := range streams {
-				for _, message := range stream.Messages {
-					if err := s.processMessage(ctx, message); err != nil {
-						log.Printf("Error processing message %s: %v", message.ID, err)
-						continue
-					}
+		if err != nil && err != redis.Nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf("Error reading from stream: %v", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
 
-					// Acknowledge message
-					s.redis.XAck(ctx, EventsStreamName, ConsumerGroup, message.ID)
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				row, err := messageRow(message)
+				if err != nil {
+					// Malformed events never succeed, so don't retry them
+					log.Printf("Error processing message %s: %v", message.ID, err)
+					s.deadLetter(ctx, message, 1, err.Error())
+					continue
 				}
+				if len(batch) == 0 {
+					deadline = time.Now().Add(s.flushInterval)
+				}
+				batch = append(batch, batchEvent{message: message, row: row, deliveries: 1})
 			}
 		}
+
+		if len(batch) >= s.batchSize {
+			flush(ctx)
+		}
+	}
+}
+
+// batchEvent is a stream message on its way to gadget_events
+type batchEvent struct {
+	message    redis.XMessage
+	row        []interface{}
+	deliveries int64 // including the current one
+}
+
+// insertEventQuery stores one event unless it is already stored, as a
+// redelivered event may be. Events are told apart by session and sequence
+// number, so events without one are always inserted.
+const insertEventQuery = `
+	INSERT INTO gadget_events (time, session_id, event_type, namespace, pod_name, data, frame, seq)
+	SELECT $1::timestamptz, $2::text, $3::text, $4::text, $5::text, $6::jsonb, $7::bigint, $8::bigint
+	WHERE $8::bigint IS NULL OR NOT EXISTS (
+		SELECT 1 FROM gadget_events WHERE session_id = $2 AND seq = $8 AND time = $1
+	)
+`
+
+// writeBatch stores a batch of events not stored yet and acknowledges their
+// stream messages. COPY is a single statement, so the batch is written
+// entirely or not at all; if it fails, the events are written one at a time
+// so that one bad event doesn't hold back the others, see writeEvents.
+func (s *Storage) writeBatch(ctx context.Context, batch []batchEvent) error {
+	rows := make([][]interface{}, len(batch))
+	for i, event := range batch {
+		rows[i] = event.row
+	}
+	if _, err := s.db.CopyFrom(ctx, pgx.Identifier{"gadget_events"}, eventColumns, pgx.CopyFromRows(rows)); err != nil {
+		log.Printf("Failed to copy batch of %d events, writing them one at a time: %v", len(batch), err)
+		return s.writeEvents(ctx, batch)
+	}
+
+	// The events are stored; if the ack fails they are redelivered and
+	// skipped by writeEvents
+	ids := make([]string, len(batch))
+	for i, event := range batch {
+		ids[i] = event.message.ID
+	}
+	if err := s.redis.XAck(ctx, EventsStreamName, ConsumerGroup, ids...).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge events: %w", err)
 	}
+	return nil
 }
 
-// processMessage processes a single message from the stream
-func (s *Storage) processMessage(ctx context.Context, msg redis.XMessage) error {
+// writeEvents stores events one at a time, skipping those already stored,
+// and acknowledges them. Events the database rejects are dead-lettered;
+// any other failure stops the write and leaves the remaining events
+// pending.
+func (s *Storage) writeEvents(ctx context.Context, events []batchEvent) error {
+	var stored []string
+	var err error
+	for _, event := range events {
+		if _, err = s.db.Exec(ctx, insertEventQuery, event.row...); err != nil {
+			if !isRejected(err) {
+				err = fmt.Errorf("failed to insert event into database: %w", err)
+				break
+			}
+			s.deadLetter(ctx, event.message, event.deliveries, err.Error())
+			err = nil
+			continue
+		}
+		stored = append(stored, event.message.ID)
+	}
+
+	if len(stored) > 0 {
+		if ackErr := s.redis.XAck(ctx, EventsStreamName, ConsumerGroup, stored...).Err(); ackErr != nil && err == nil {
+			err = fmt.Errorf("failed to acknowledge events: %w", ackErr)
+		}
+	}
+	return err
+}
+
+// isRejected reports whether the database refused an event itself, e.g.
+// for data it can't store, as opposed to failing to process it. Such events
+// fail however often they are retried.
+func isRejected(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	// Data exceptions and integrity constraint violations
+	return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+}
+
+// messageRow converts a stream message into a gadget_events row
+func messageRow(msg redis.XMessage) ([]interface{}, error) {
 	// Extract fields
 	sessionID, _ := msg.Values["session_id"].(string)
 	eventType, _ := msg.Values["event_type"].(string)
@@ -163,54 +409,86 @@ func (s *Storage) processMessage(ctx context.Context, msg redis.XMessage) error
 	// Parse timestamp
 	timestamp, err := time.Parse(time.RFC3339Nano, timestampStr)
 	if err != nil {
-		return fmt.Errorf("failed to parse timestamp: %w", err)
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
 	}
 
 	// Parse event data
 	var event models.GadgetOutput
 	if err := json.Unmarshal([]byte(dataStr), &event); err != nil {
-		return fmt.Errorf("failed to unmarshal event: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
 	}
 
+	return eventRow(timestamp, sessionID, eventType, event)
+}
+
+// eventColumns are the gadget_events columns filled by eventRow
+var eventColumns = []string{"time", "session_id", "event_type", "namespace", "pod_name", "data", "frame", "seq"}
+
+// eventRow returns the gadget_events values of an event, see eventColumns
+func eventRow(timestamp time.Time, sessionID, eventType string, event models.GadgetOutput) ([]interface{}, error) {
 	// Extract namespace and pod_name from event data if available
+	namespace, podName := extractK8sMetadata(event.Data)
+
+	dataJSON, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	// Frame is only set for interval (top) gadgets
+	var frame *int64
+	if event.Frame > 0 {
+		frame = &event.Frame
+	}
+
+	// Events published before sequence numbers were introduced have none
+	var seq *int64
+	if event.Seq > 0 {
+		seq = &event.Seq
+	}
+
+	return []interface{}{timestamp, sessionID, eventType, namespace, podName, dataJSON, frame, seq}, nil
+}
+
+// extractK8sMetadata extracts the namespace and pod name from gadget event data.
+// Gadgets report them in different places depending on the gadget and the
+// Inspektor Gadget version, so several layouts are checked in order.
+func extractK8sMetadata(data map[string]interface{}) (namespace, podName string) {
 	// Try top-level first
-	namespace, _ := event.Data["namespace"].(string)
-	podName, _ := event.Data["pod"].(string)
+	namespace, _ = data["namespace"].(string)
+	podName, _ = data["pod"].(string)
 	if podName == "" {
-		podName, _ = event.Data["podName"].(string)
+		podName, _ = data["podName"].(string)
 	}
 
-	// If not found, try nested k8s object (common in trace gadgets)
-	if namespace == "" {
-		if k8sData, ok := event.Data["k8s"].(map[string]interface{}); ok {
+	// Nested k8s object (common in trace gadgets: trace_tcp, trace_dns,
+	// trace_exec, trace_open)
+	if k8sData, ok := data["k8s"].(map[string]interface{}); ok {
+		if namespace == "" {
 			namespace, _ = k8sData["namespace"].(string)
-			if podName == "" {
-				podName, _ = k8sData["podName"].(string)
-			}
+		}
+		if podName == "" {
+			podName, _ = k8sData["podName"].(string)
+		}
+		if podName == "" {
+			podName, _ = k8sData["pod"].(string)
 		}
 	}
 
-	// Insert into TimescaleDB
-	dataJSON, err := json.Marshal(event.Data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
+	// Flattened keys, as emitted by some image-based gadgets
+	if namespace == "" {
+		namespace, _ = data["k8s.namespace"].(string)
 	}
-
-	query := `
-		INSERT INTO gadget_events (time, session_id, event_type, namespace, pod_name, data)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
-
-	_, err = s.db.Exec(ctx, query, timestamp, sessionID, eventType, namespace, podName, dataJSON)
-	if err != nil {
-		return fmt.Errorf("failed to insert event into database: %w", err)
+	if podName == "" {
+		podName, _ = data["k8s.podName"].(string)
 	}
 
-	return nil
+	return namespace, podName
 }
 
-// QueryEvents retrieves events from TimescaleDB
-func (s *Storage) QueryEvents(ctx context.Context, filterInterface interface{}) ([]models.GadgetOutput, error) {
+// QueryEvents retrieves a page of events from TimescaleDB, newest first
+// unless the filter's order is "asc". Only paged queries (the filter's
+// "paged" is true) get a NextCursor.
+func (s *Storage) QueryEvents(ctx context.Context, filterInterface interface{}) (*models.EventPage, error) {
 	// Convert interface{} to map
 	filterMap, ok := filterInterface.(map[string]interface{})
 	if !ok {
@@ -218,7 +496,7 @@ func (s *Storage) QueryEvents(ctx context.Context, filterInterface interface{})
 	}
 
 	query := `
-		SELECT time, session_id, event_type, namespace, pod_name, data
+		SELECT time, session_id, event_type, namespace, pod_name, data, frame, seq
 		FROM gadget_events
 		WHERE 1=1
 	`
@@ -244,6 +522,12 @@ func (s *Storage) QueryEvents(ctx context.Context, filterInterface interface{})
 		argPos++
 	}
 
+	if frame, ok := filterMap["frame"].(int64); ok && frame > 0 {
+		query += fmt.Sprintf(" AND frame = $%d", argPos)
+		args = append(args, frame)
+		argPos++
+	}
+
 	if startTime, ok := filterMap["start_time"].(time.Time); ok && !startTime.IsZero() {
 		query += fmt.Sprintf(" AND time >= $%d", argPos)
 		args = append(args, startTime)
@@ -256,51 +540,353 @@ func (s *Storage) QueryEvents(ctx context.Context, filterInterface interface{})
 		argPos++
 	}
 
-	// Order by time and limit
-	query += " ORDER BY time DESC"
-	if limit, ok := filterMap["limit"].(int); ok && limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d", argPos)
-		args = append(args, limit)
-	} else {
-		query += " LIMIT 1000" // Default limit
+	// Predicates on the event payload
+	if expr, ok := filterMap["query"].(*filter.Expr); ok && expr != nil {
+		var cond string
+		cond, args = expr.SQL("data", args)
+		query += " AND " + cond
+		argPos = len(args) + 1
+	}
+
+	// Keyset pagination: continue after the cursor in (time, session_id,
+	// seq) order, which is unique since seq is unique within a session.
+	// Rows stored before seq existed have no position in that order, so
+	// paged queries leave them out.
+	direction, comparison := "DESC", "<"
+	if order, _ := filterMap["order"].(string); order == "asc" {
+		direction, comparison = "ASC", ">"
+	}
+	paged, _ := filterMap["paged"].(bool)
+	if paged {
+		query += " AND seq IS NOT NULL"
+	}
+	if cursor, ok := filterMap["cursor"].(*models.EventCursor); ok && cursor != nil {
+		query += fmt.Sprintf(" AND (time, session_id, seq) %s ($%d, $%d, $%d)",
+			comparison, argPos, argPos+1, argPos+2)
+		args = append(args, cursor.Time, cursor.SessionID, cursor.Seq)
+		argPos += 3
 	}
 
+	limit := DefaultPageSize
+	if l, ok := filterMap["limit"].(int); ok && l > 0 {
+		limit = min(l, MaxPageSize)
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	query += fmt.Sprintf(" ORDER BY time %s, session_id %s, seq %s LIMIT $%d",
+		direction, direction, direction, argPos)
+	args = append(args, limit+1)
+
 	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query events: %w", err)
 	}
 	defer rows.Close()
 
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.EventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		if paged {
+			page.NextCursor = models.CursorAfter(events[limit-1]).Encode()
+		}
+	}
+	if page.Events == nil {
+		page.Events = []models.GadgetOutput{}
+	}
+	return page, nil
+}
+
+// scanEvents reads gadget_events rows selected as
+// time, session_id, event_type, namespace, pod_name, data, frame, seq
+func scanEvents(rows pgx.Rows) ([]models.GadgetOutput, error) {
 	var events []models.GadgetOutput
 	for rows.Next() {
-		var (
-			timestamp time.Time
-			sessionID string
-			eventType string
-			namespace *string
-			podName   *string
-			dataJSON  []byte
-		)
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
 
-		err := rows.Scan(&timestamp, &sessionID, &eventType, &namespace, &podName, &dataJSON)
+	return events, rows.Err()
+}
+
+// scanEvent reads the current row of a gadget_events query, see scanEvents
+func scanEvent(rows pgx.Rows) (models.GadgetOutput, error) {
+	var (
+		timestamp time.Time
+		sessionID string
+		eventType string
+		namespace *string
+		podName   *string
+		dataJSON  []byte
+		frame     *int64
+		seq       *int64
+	)
+
+	err := rows.Scan(&timestamp, &sessionID, &eventType, &namespace, &podName, &dataJSON, &frame, &seq)
+	if err != nil {
+		return models.GadgetOutput{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(dataJSON, &data); err != nil {
+		return models.GadgetOutput{}, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	event := models.GadgetOutput{
+		SessionID: sessionID,
+		EventType: eventType,
+		Timestamp: timestamp,
+		Data:      data,
+	}
+	if frame != nil {
+		event.Frame = *frame
+		event.FrameTime = &timestamp
+	}
+	if seq != nil {
+		event.Seq = *seq
+	}
+	return event, nil
+}
+
+// EventsSince returns a session's events with a seq greater than since, in
+// seq order. Recent events are read from the Redis stream, which also holds
+// events the consumer has not persisted yet; older ones come from
+// TimescaleDB. At most MaxBackfillEvents of the newest events are returned;
+// truncated reports whether older events after since were left out.
+func (s *Storage) EventsSince(ctx context.Context, sessionID string, since int64) (events []models.GadgetOutput, truncated bool, err error) {
+	// One more event than returned tells whether the result is truncated
+	limit := MaxBackfillEvents + 1
+
+	recent, complete, err := s.scanStream(ctx, sessionID, since, limit)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !complete {
+		// Everything between since and the oldest event still found in the
+		// stream has to come from TimescaleDB
+		until := int64(math.MaxInt64)
+		if len(recent) > 0 {
+			until = recent[len(recent)-1].Seq
+		}
+
+		query := `
+			SELECT time, session_id, event_type, namespace, pod_name, data, frame, seq
+			FROM gadget_events
+			WHERE session_id = $1 AND seq > $2 AND seq < $3
+			ORDER BY seq DESC
+			LIMIT $4
+		`
+		rows, err := s.db.Query(ctx, query, sessionID, since, until, limit-len(recent))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to query events: %w", err)
+		}
+		older, err := scanEvents(rows)
+		rows.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		recent = append(recent, older...)
+	}
+
+	if len(recent) > MaxBackfillEvents {
+		recent = recent[:MaxBackfillEvents]
+		truncated = true
+	}
+
+	// Both sources were read newest first
+	for i := len(recent) - 1; i >= 0; i-- {
+		events = append(events, recent[i])
+	}
+	return events, truncated, nil
+}
+
+// LastSeq returns the highest seq recorded for a session, or 0 if none
+func (s *Storage) LastSeq(ctx context.Context, sessionID string) (int64, error) {
+	// The newest event in the stream, if it is still there, is the last one
+	recent, _, err := s.scanStream(ctx, sessionID, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(recent) > 0 {
+		return recent[0].Seq, nil
+	}
+
+	var seq *int64
+	query := `SELECT MAX(seq) FROM gadget_events WHERE session_id = $1`
+	if err := s.db.QueryRow(ctx, query, sessionID).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to query last seq: %w", err)
+	}
+	if seq == nil {
+		return 0, nil
+	}
+	return *seq, nil
+}
+
+// scanStream walks the events stream from the newest entry backwards,
+// collecting up to limit of a session's events with a seq greater than since,
+// newest first. complete reports whether the scan stopped because it reached
+// since or the limit, rather than running out of stream to scan.
+func (s *Storage) scanStream(ctx context.Context, sessionID string, since int64, limit int) (events []models.GadgetOutput, complete bool, err error) {
+	end := "+"
+	for scanned := 0; scanned < maxStreamScan; {
+		messages, err := s.redis.XRevRangeN(ctx, EventsStreamName, end, "-", streamScanBatch).Result()
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return nil, false, fmt.Errorf("failed to read events stream: %w", err)
 		}
 
-		var data map[string]interface{}
-		if err := json.Unmarshal(dataJSON, &data); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+		for _, message := range messages {
+			if id, _ := message.Values["session_id"].(string); id != sessionID {
+				continue
+			}
+
+			dataStr, _ := message.Values["data"].(string)
+			var event models.GadgetOutput
+			if err := json.Unmarshal([]byte(dataStr), &event); err != nil || event.Seq == 0 {
+				continue
+			}
+			if event.Seq <= since {
+				return events, true, nil
+			}
+
+			events = append(events, event)
+			if len(events) >= limit {
+				return events, true, nil
+			}
 		}
 
-		events = append(events, models.GadgetOutput{
-			SessionID: sessionID,
-			EventType: eventType,
-			Timestamp: timestamp,
-			Data:      data,
-		})
+		if len(messages) < streamScanBatch {
+			// Reached the start of the stream
+			break
+		}
+		scanned += len(messages)
+		end = "(" + messages[len(messages)-1].ID
 	}
 
-	return events, nil
+	return events, false, nil
+}
+
+// GetSessionFrames lists the frames recorded for an interval (top) gadget session
+func (s *Storage) GetSessionFrames(ctx context.Context, sessionID string) (interface{}, error) {
+	query := `
+		SELECT frame, MIN(time), COUNT(*)
+		FROM gadget_events
+		WHERE session_id = $1 AND frame IS NOT NULL
+		GROUP BY frame
+		ORDER BY frame
+	`
+
+	rows, err := s.db.Query(ctx, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query frames: %w", err)
+	}
+	defer rows.Close()
+
+	frames := []FrameInfo{}
+	for rows.Next() {
+		var frame FrameInfo
+		if err := rows.Scan(&frame.Frame, &frame.Time, &frame.Rows); err != nil {
+			return nil, fmt.Errorf("failed to scan frame: %w", err)
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames, rows.Err()
+}
+
+// StreamSessionEvents calls fn with every stored event of a session, oldest
+// first, without holding them all in memory. It stops at the first error fn
+// returns.
+func (s *Storage) StreamSessionEvents(ctx context.Context, sessionID string, fn func(models.GadgetOutput) error) error {
+	query := `
+		SELECT time, session_id, event_type, namespace, pod_name, data, frame, seq
+		FROM gadget_events
+		WHERE session_id = $1
+		ORDER BY time, COALESCE(seq, 0)
+	`
+
+	rows, err := s.db.Query(ctx, query, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// SessionType returns the gadget type a session was recorded with, or ""
+// for an unknown session
+func (s *Storage) SessionType(ctx context.Context, sessionID string) (models.GadgetType, error) {
+	var gadgetType models.GadgetType
+	err := s.db.QueryRow(ctx, `SELECT type FROM gadget_sessions WHERE id = $1`, sessionID).Scan(&gadgetType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get session type: %w", err)
+	}
+	return gadgetType, nil
+}
+
+// SessionEventFields lists the dotted paths of the leaf fields found in the
+// data of a session's first sample events, e.g. "dst.k8s.name", sorted by
+// name
+func (s *Storage) SessionEventFields(ctx context.Context, sessionID string, sample int) ([]string, error) {
+	query := `
+		WITH RECURSIVE events AS (
+			SELECT data
+			FROM gadget_events
+			WHERE session_id = $1
+			ORDER BY time
+			LIMIT $2
+		), fields(path, value) AS (
+			SELECT f.key, f.value
+			FROM events, jsonb_each(data) f
+			WHERE jsonb_typeof(data) = 'object'
+			UNION ALL
+			SELECT fields.path || '.' || f.key, f.value
+			FROM fields, jsonb_each(fields.value) f
+			WHERE jsonb_typeof(fields.value) = 'object'
+		)
+		SELECT DISTINCT path
+		FROM fields
+		WHERE jsonb_typeof(value) <> 'object'
+		ORDER BY path
+	`
+
+	rows, err := s.db.Query(ctx, query, sessionID, sample)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []string{}
+	for rows.Next() {
+		var field string
+		if err := rows.Scan(&field); err != nil {
+			return nil, fmt.Errorf("failed to scan event field: %w", err)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, rows.Err()
 }
 
 // RecordSessionStart records when a session starts
@@ -325,20 +911,111 @@ func (s *Storage) RecordSessionStart(ctx context.Context, session models.GadgetS
 	return err
 }
 
-// RecordSessionEnd records when a session ends
+// ImportSession stores a session recorded elsewhere. next returns the
+// session's events one at a time and nil once they are exhausted. The
+// events and a gadget_sessions row with status "imported", spanning the
+// events' time range, are written in one transaction, so a failed import
+// leaves nothing behind. It returns the number of events imported.
+func (s *Storage) ImportSession(ctx context.Context, session models.GadgetSession, next func() (*models.GadgetOutput, error)) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		count      int64
+		start, end time.Time
+		rows       = make([][]interface{}, 0, importBatchSize)
+	)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"gadget_events"}, eventColumns, pgx.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("failed to insert events: %w", err)
+		}
+		rows = rows[:0]
+		return nil
+	}
+
+	for {
+		event, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if event == nil {
+			break
+		}
+
+		row, err := eventRow(event.Timestamp, session.ID, event.EventType, *event)
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, row)
+		count++
+
+		if start.IsZero() || event.Timestamp.Before(start) {
+			start = event.Timestamp
+		}
+		if event.Timestamp.After(end) {
+			end = event.Timestamp
+		}
+
+		if len(rows) == importBatchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO gadget_sessions (id, type, namespace, pod_name, status, start_time, end_time)
+		VALUES ($1, $2, $3, $4, 'imported', $5, $6)
+	`
+	if _, err := tx.Exec(ctx, query, session.ID, session.Type, session.Namespace, session.PodName, start, end); err != nil {
+		return 0, fmt.Errorf("failed to record imported session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return count, nil
+}
+
+// RecordSessionEnd records when a session ends. A failed session keeps
+// its status and reason.
 func (s *Storage) RecordSessionEnd(ctx context.Context, sessionID string) error {
 	query := `
 		UPDATE gadget_sessions
 		SET status = 'stopped',
 		    end_time = NOW(),
 		    updated_at = NOW()
-		WHERE id = $1
+		WHERE id = $1 AND status <> 'failed'
 	`
 
 	_, err := s.db.Exec(ctx, query, sessionID)
 	return err
 }
 
+// RecordSessionFailure records that a session failed and why
+func (s *Storage) RecordSessionFailure(ctx context.Context, sessionID string, reason string) error {
+	query := `
+		UPDATE gadget_sessions
+		SET status = 'failed',
+		    reason = $2,
+		    end_time = NOW(),
+		    updated_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := s.db.Exec(ctx, query, sessionID, reason)
+	return err
+}
+
 // GetSessionStats retrieves statistics for a session
 func (s *Storage) GetSessionStats(ctx context.Context, sessionID string) (interface{}, error) {
 	query := `
@@ -350,13 +1027,14 @@ func (s *Storage) GetSessionStats(ctx context.Context, sessionID string) (interf
 			s.status,
 			s.start_time,
 			s.end_time,
+			COALESCE(s.reason, '') as reason,
 			COUNT(e.time) as event_count,
 			MIN(e.time) as first_event,
 			MAX(e.time) as last_event
 		FROM gadget_sessions s
 		LEFT JOIN gadget_events e ON s.id = e.session_id
 		WHERE s.id = $1
-		GROUP BY s.id, s.type, s.namespace, s.pod_name, s.status, s.start_time, s.end_time
+		GROUP BY s.id, s.type, s.namespace, s.pod_name, s.status, s.start_time, s.end_time, s.reason
 	`
 
 	var stats SessionStats
@@ -371,6 +1049,7 @@ func (s *Storage) GetSessionStats(ctx context.Context, sessionID string) (interf
 		&stats.Status,
 		&stats.StartTime,
 		&endTime,
+		&stats.Reason,
 		&stats.EventCount,
 		&firstEvent,
 		&lastEvent,
@@ -422,7 +1101,15 @@ type SessionStats struct {
 	Status     string    `json:"status"`
 	StartTime  time.Time `json:"start_time"`
 	EndTime    time.Time `json:"end_time,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
 	EventCount int64     `json:"event_count"`
 	FirstEvent time.Time `json:"first_event,omitempty"`
 	LastEvent  time.Time `json:"last_event,omitempty"`
 }
+
+// FrameInfo describes one frame of an interval (top) gadget session
+type FrameInfo struct {
+	Frame int64     `json:"frame"`
+	Time  time.Time `json:"time"`
+	Rows  int64     `json:"rows"`
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamStats reports how far event persistence is behind the event stream
+type StreamStats struct {
+	Stream  string `json:"stream"`
+	Length  int64  `json:"length"`
+	FirstID string `json:"firstId,omitempty"`
+	LastID  string `json:"lastId,omitempty"`
+	Group   string `json:"group"`
+	// Lag counts the events not yet delivered to the consumer group, as
+	// reported by Redis 7 (zero when Redis can't tell, -1 without the
+	// group), and LagSeconds is the age of the oldest of them
+	Lag             int64   `json:"lag"`
+	LagSeconds      float64 `json:"lagSeconds"`
+	LastDeliveredID string  `json:"lastDeliveredId,omitempty"`
+	// Pending counts the events delivered but not yet stored, and
+	// OldestPendingSeconds is the age of the oldest of them
+	Pending              int64           `json:"pending"`
+	OldestPendingSeconds float64         `json:"oldestPendingSeconds"`
+	Consumers            []ConsumerStats `json:"consumers"`
+	DeadLetters          int64           `json:"deadLetters"`
+}
+
+// ConsumerStats describes one consumer of the group
+type ConsumerStats struct {
+	Name        string  `json:"name"`
+	Pending     int64   `json:"pending"`
+	IdleSeconds float64 `json:"idleSeconds"`
+}
+
+// GetStreamStats reports the length of the event stream and the consumer
+// group's progress through it
+func (s *Storage) GetStreamStats(ctx context.Context) (interface{}, error) {
+	length, first, last, err := s.streamBounds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := StreamStats{
+		Stream:    EventsStreamName,
+		Length:    length,
+		FirstID:   first,
+		LastID:    last,
+		Group:     ConsumerGroup,
+		Lag:       -1,
+		Consumers: []ConsumerStats{},
+	}
+
+	groups, err := s.redis.XInfoGroups(ctx, EventsStreamName).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe consumer groups: %w", err)
+	}
+	for _, group := range groups {
+		if group.Name == ConsumerGroup {
+			stats.Lag = group.Lag
+			stats.LastDeliveredID = group.LastDeliveredID
+		}
+	}
+
+	// The oldest undelivered event follows the last delivered one
+	if stats.LastDeliveredID != "" {
+		next, err := s.redis.XRangeN(ctx, EventsStreamName, "("+stats.LastDeliveredID, "+", 1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read undelivered events: %w", err)
+		}
+		if len(next) > 0 {
+			stats.LagSeconds = streamIDAge(next[0].ID)
+		}
+	}
+
+	pending, err := s.redis.XPending(ctx, EventsStreamName, ConsumerGroup).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending events: %w", err)
+	}
+	stats.Pending = pending.Count
+	if pending.Count > 0 {
+		stats.OldestPendingSeconds = streamIDAge(pending.Lower)
+	}
+
+	consumers, err := s.redis.XInfoConsumers(ctx, EventsStreamName, ConsumerGroup).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consumers: %w", err)
+	}
+	for _, consumer := range consumers {
+		stats.Consumers = append(stats.Consumers, ConsumerStats{
+			Name:        consumer.Name,
+			Pending:     consumer.Pending,
+			IdleSeconds: consumer.Idle.Seconds(),
+		})
+	}
+
+	if stats.DeadLetters, err = s.redis.XLen(ctx, DeadLetterStreamName).Result(); err != nil {
+		return nil, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+
+	return stats, nil
+}
+
+// trimStream removes stored events from the stream once it holds more than
+// StreamMaxLen entries or entries older than StreamMaxAge. Events the
+// consumer group hasn't acknowledged are never removed. Trimming is
+// approximate: the length limit assumes events are spread evenly over the
+// stream's time span, and Redis trims whole radix tree nodes only.
+func (s *Storage) trimStream(ctx context.Context) error {
+	length, firstID, lastID, err := s.streamBounds(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target streamID
+	if s.streamMaxLen > 0 && length > s.streamMaxLen {
+		first, err1 := parseStreamID(firstID)
+		last, err2 := parseStreamID(lastID)
+		if err1 == nil && err2 == nil {
+			span := last.ms - first.ms
+			target = streamID{ms: last.ms - uint64(float64(span)*float64(s.streamMaxLen)/float64(length))}
+		}
+	}
+	if s.streamMaxAge > 0 {
+		if age := (streamID{ms: uint64(time.Now().Add(-s.streamMaxAge).UnixMilli())}); target.less(age) {
+			target = age
+		}
+	}
+	if target.isZero() {
+		return nil
+	}
+
+	// Keep everything from the oldest unacknowledged event on
+	keep, err := s.oldestUnacknowledged(ctx)
+	if err != nil {
+		return err
+	}
+	if keep.less(target) {
+		target = keep
+	}
+	if target.isZero() {
+		return nil
+	}
+
+	if err := s.redis.XTrimMinIDApprox(ctx, EventsStreamName, target.String(), 0).Err(); err != nil {
+		return fmt.Errorf("failed to trim stream: %w", err)
+	}
+	return nil
+}
+
+// streamBounds returns the length of the event stream and the IDs of its
+// first and last entries
+func (s *Storage) streamBounds(ctx context.Context) (int64, string, string, error) {
+	length, err := s.redis.XLen(ctx, EventsStreamName).Result()
+	if err != nil {
+		return 0, "", "", fmt.Errorf("failed to get stream length: %w", err)
+	}
+	if length == 0 {
+		return 0, "", "", nil
+	}
+
+	first, err := s.redis.XRangeN(ctx, EventsStreamName, "-", "+", 1).Result()
+	if err != nil {
+		return 0, "", "", fmt.Errorf("failed to read stream: %w", err)
+	}
+	last, err := s.redis.XRevRangeN(ctx, EventsStreamName, "+", "-", 1).Result()
+	if err != nil {
+		return 0, "", "", fmt.Errorf("failed to read stream: %w", err)
+	}
+	if len(first) == 0 || len(last) == 0 {
+		return length, "", "", nil
+	}
+	return length, first[0].ID, last[0].ID, nil
+}
+
+// oldestUnacknowledged returns the ID of the oldest event the consumer group
+// still needs: its oldest pending event, or else the last one delivered
+func (s *Storage) oldestUnacknowledged(ctx context.Context) (streamID, error) {
+	pending, err := s.redis.XPending(ctx, EventsStreamName, ConsumerGroup).Result()
+	if err != nil {
+		return streamID{}, fmt.Errorf("failed to read pending events: %w", err)
+	}
+	if pending.Count > 0 {
+		return parseStreamID(pending.Lower)
+	}
+
+	groups, err := s.redis.XInfoGroups(ctx, EventsStreamName).Result()
+	if err != nil {
+		return streamID{}, fmt.Errorf("failed to describe consumer groups: %w", err)
+	}
+	for _, group := range groups {
+		if group.Name == ConsumerGroup {
+			return parseStreamID(group.LastDeliveredID)
+		}
+	}
+	// Without the group nothing is known to be stored
+	return streamID{}, nil
+}
+
+// streamID is a parsed Redis stream entry ID, <milliseconds>-<sequence>
+type streamID struct {
+	ms, seq uint64
+}
+
+func parseStreamID(id string) (streamID, error) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, fmt.Errorf("invalid stream ID %q", id)
+	}
+	var seq uint64
+	if seqPart != "" {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return streamID{}, fmt.Errorf("invalid stream ID %q", id)
+		}
+	}
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+func (id streamID) isZero() bool {
+	return id.ms == 0 && id.seq == 0
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+// streamIDAge returns how many seconds ago a stream entry was added
+func streamIDAge(id string) float64 {
+	parsed, err := parseStreamID(id)
+	if err != nil {
+		return 0
+	}
+	return time.Since(time.UnixMilli(int64(parsed.ms))).Seconds()
+}
@@ -27,9 +27,9 @@ else
     TARGETARCH="amd64"
 fi
 
-# Build backend
+# Build backend (from the repository root, so the demo recordings are in the context)
 echo "Building backend image..."
-$CONTAINER_RUNTIME build --platform $PLATFORM --build-arg TARGETARCH=$TARGETARCH -t penny-backend:latest ./backend
+$CONTAINER_RUNTIME build --platform $PLATFORM --build-arg TARGETARCH=$TARGETARCH -t penny-backend:latest -f backend/Dockerfile .
 
 # Build frontend
 echo "Building frontend image..."
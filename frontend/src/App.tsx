@@ -1,4 +1,4 @@
-import { useEffect, useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import {
   Activity,
   BarChart2,
@@ -10,7 +10,13 @@ import {
   Zap,
   Network,
   Lock,
-  History
+  History,
+  Globe,
+  Terminal,
+  FileText,
+  Gauge,
+  FolderOpen,
+  HardDrive
 } from 'lucide-react';
 import { GadgetCard } from './components/GadgetCard';
 import { Runner } from './components/Runner';
@@ -20,7 +26,7 @@ import { HistoryView } from './components/HistoryView';
 import { SessionReplay } from './components/SessionReplay';
 import { ThemeToggle } from './components/ThemeToggle';
 import { ThemeProvider } from './contexts/ThemeContext';
-import { GadgetRequest, GadgetSession, GadgetOutput as GadgetOutputType } from './types';
+import { GadgetRequest, GadgetSession, GadgetType, GadgetOutput as GadgetOutputType } from './types';
 import { api } from './services/api';
 
 interface Gadget {
@@ -29,7 +35,7 @@ interface Gadget {
   description: string;
   category: 'trace' | 'top' | 'snapshot' | 'profile' | 'audit';
   icon: any;
-  type: 'trace_sni' | 'trace_tcp' | 'snapshot_process' | 'snapshot_socket';
+  type: GadgetType;
 }
 
 function App() {
@@ -44,6 +50,8 @@ function App() {
   const [showSessionPicker, setShowSessionPicker] = useState(false);
   const [sessionPickerGadget, setSessionPickerGadget] = useState<Gadget | null>(null);
   const [replaySessionId, setReplaySessionId] = useState<string | null>(null);
+  // Seq of the last event received per session, used to resume after a reconnect
+  const lastSeqs = useRef<Map<string, number>>(new Map());
 
   // Define available gadgets
   const gadgets: Gadget[] = [
@@ -63,6 +71,54 @@ function App() {
       icon: Activity,
       type: 'trace_tcp'
     },
+    {
+      id: 'trace-dns',
+      title: 'Trace DNS',
+      description: 'Trace DNS queries and responses with their latency.',
+      category: 'trace',
+      icon: Globe,
+      type: 'trace_dns'
+    },
+    {
+      id: 'trace-exec',
+      title: 'Trace Exec',
+      description: 'Trace new processes and the arguments they were started with.',
+      category: 'trace',
+      icon: Terminal,
+      type: 'trace_exec'
+    },
+    {
+      id: 'trace-open',
+      title: 'Trace Open',
+      description: 'Trace files opened by processes, including failed opens.',
+      category: 'trace',
+      icon: FileText,
+      type: 'trace_open'
+    },
+    {
+      id: 'top-tcp',
+      title: 'Top TCP',
+      description: 'Periodically rank connections by bytes sent and received.',
+      category: 'top',
+      icon: Gauge,
+      type: 'top_tcp'
+    },
+    {
+      id: 'top-file',
+      title: 'Top File',
+      description: 'Periodically rank files by read and write activity.',
+      category: 'top',
+      icon: FolderOpen,
+      type: 'top_file'
+    },
+    {
+      id: 'top-block-io',
+      title: 'Top Block I/O',
+      description: 'Periodically rank processes by block device I/O.',
+      category: 'top',
+      icon: HardDrive,
+      type: 'top_block_io'
+    },
     {
       id: 'snapshot-process',
       title: 'Snapshot Process',
@@ -133,7 +189,7 @@ function App() {
       return newSet;
     });
 
-    const wsUrl = api.getWebSocketUrl(sessionId);
+    const wsUrl = api.getWebSocketUrl(sessionId, lastSeqs.current.get(sessionId));
     const websocket = new WebSocket(wsUrl);
 
     websocket.onopen = () => {
@@ -163,6 +219,11 @@ function App() {
           return;
         }
 
+        if (message.type === 'gap') {
+          setError(`Missed ${message.before - message.after - 1} events while disconnected`);
+          return;
+        }
+
         if (message.type === 'session_ended') {
           console.log('Session ended:', message.status);
           loadSessions();
@@ -171,6 +232,9 @@ function App() {
 
         // Regular gadget output - append to the specific session's outputs
         if (message.data) {
+          if (message.seq) {
+            lastSeqs.current.set(sessionId, message.seq);
+          }
           setSessionOutputs((prev) => {
             const newMap = new Map(prev);
             const existing = newMap.get(sessionId) || [];
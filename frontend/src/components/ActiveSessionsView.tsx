@@ -1,6 +1,6 @@
 import React from 'react';
 import { Play, X, Clock, Activity } from 'lucide-react';
-import { GadgetSession, GadgetOutput } from '../types';
+import { GadgetSession, GadgetOutput, GadgetType } from '../types';
 
 interface Gadget {
   id: string;
@@ -8,7 +8,7 @@ interface Gadget {
   description: string;
   category: 'trace' | 'top' | 'snapshot' | 'profile' | 'audit';
   icon: any;
-  type: 'trace_sni' | 'trace_tcp' | 'snapshot_process' | 'snapshot_socket';
+  type: GadgetType;
 }
 
 interface Props {
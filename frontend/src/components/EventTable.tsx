@@ -0,0 +1,222 @@
+import React, { useMemo, useState } from 'react';
+import { Download, Search, ArrowUpDown, Table } from 'lucide-react';
+import { GadgetOutput } from '../types';
+
+// Column of an EventTable; value extracts the cell from an event's data
+export interface EventColumn {
+  key: string;
+  label: string;
+  value: (data: Record<string, any>) => string | number;
+  badge?: string; // Tailwind classes rendering the cell as a badge
+}
+
+interface Props {
+  title: string;
+  outputs: GadgetOutput[];
+  columns: EventColumn[];
+  emptyHint: string;
+  exportName: string; // CSV file name prefix
+  defaultSort?: string; // column key sorted descending at first, timestamp by default
+}
+
+type SortOrder = 'asc' | 'desc';
+
+// Common columns identifying where an event came from
+export const k8sColumns: EventColumn[] = [
+  { key: 'namespace', label: 'Namespace', value: d => String(d.namespace || d.k8s?.namespace || 'unknown'),
+    badge: 'bg-slate-200 dark:bg-slate-800 text-slate-700 dark:text-slate-300' },
+  { key: 'pod', label: 'Pod', value: d => String(d.pod || d.k8s?.podName || d.k8s?.pod || 'unknown') },
+  { key: 'container', label: 'Container', value: d => String(d.container || d.k8s?.containerName || d.k8s?.container || 'unknown'),
+    badge: 'bg-blue-500/20 text-blue-700 dark:text-blue-400' },
+  { key: 'comm', label: 'Process', value: d => String(d.comm || d.proc?.comm || 'unknown'),
+    badge: 'bg-green-500/20 text-green-700 dark:text-green-400' },
+  { key: 'pid', label: 'PID', value: d => Number(d.pid || d.proc?.pid || 0) },
+];
+
+// EventTable shows events of any gadget as a searchable, sortable table
+export const EventTable: React.FC<Props> = ({ title, outputs, columns, emptyHint, exportName, defaultSort }) => {
+  const [searchTerm, setSearchTerm] = useState('');
+  const [sortField, setSortField] = useState(defaultSort || 'timestamp');
+  const [sortOrder, setSortOrder] = useState<SortOrder>('desc');
+
+  const rows = useMemo(() => {
+    return outputs.map((output) => {
+      const row: Record<string, string | number> = {
+        timestamp: String(output.timestamp || output.data.timestamp || ''),
+      };
+      columns.forEach(column => {
+        row[column.key] = column.value(output.data || {});
+      });
+      return row;
+    });
+  }, [outputs, columns]);
+
+  const filteredAndSortedRows = useMemo(() => {
+    let filtered = rows;
+
+    if (searchTerm) {
+      const term = searchTerm.toLowerCase();
+      filtered = filtered.filter(row =>
+        columns.some(column => String(row[column.key]).toLowerCase().includes(term))
+      );
+    }
+
+    return [...filtered].sort((a, b) => {
+      const aVal = a[sortField];
+      const bVal = b[sortField];
+
+      if (typeof aVal === 'number' && typeof bVal === 'number') {
+        return sortOrder === 'asc' ? aVal - bVal : bVal - aVal;
+      }
+
+      const aStr = String(aVal).toLowerCase();
+      const bStr = String(bVal).toLowerCase();
+      return sortOrder === 'asc' ? aStr.localeCompare(bStr) : bStr.localeCompare(aStr);
+    });
+  }, [rows, columns, searchTerm, sortField, sortOrder]);
+
+  const handleSort = (field: string) => {
+    if (sortField === field) {
+      setSortOrder(sortOrder === 'asc' ? 'desc' : 'asc');
+    } else {
+      setSortField(field);
+      setSortOrder('asc');
+    }
+  };
+
+  const handleExportCSV = () => {
+    const headers = ['Timestamp', ...columns.map(column => column.label)];
+    const csvRows = filteredAndSortedRows.map(row => [
+      String(row.timestamp),
+      ...columns.map(column => String(row[column.key])),
+    ]);
+
+    const csvContent = [
+      headers.join(','),
+      ...csvRows.map(row => row.map(cell => `"${cell.replace(/"/g, '""')}"`).join(','))
+    ].join('\n');
+
+    const blob = new Blob([csvContent], { type: 'text/csv' });
+    const url = URL.createObjectURL(blob);
+    const link = document.createElement('a');
+    link.href = url;
+    link.download = `${exportName}-${Date.now()}.csv`;
+    link.click();
+    URL.revokeObjectURL(url);
+  };
+
+  if (outputs.length === 0) {
+    return (
+      <div className="h-full flex flex-col items-center justify-center text-slate-500 dark:text-slate-500">
+        <Table size={48} className="mb-4 opacity-50" />
+        <p>No data available yet...</p>
+        <p className="text-sm mt-2">{emptyHint}</p>
+      </div>
+    );
+  }
+
+  const SortIcon: React.FC<{ field: string }> = ({ field }) => {
+    if (sortField !== field) {
+      return <ArrowUpDown size={14} className="opacity-50" />;
+    }
+    return (
+      <ArrowUpDown
+        size={14}
+        className={`${sortOrder === 'asc' ? 'rotate-180' : ''} transition-transform`}
+      />
+    );
+  };
+
+  const headerClass = 'text-left p-3 text-slate-700 dark:text-slate-300 font-semibold cursor-pointer hover:bg-slate-200 dark:hover:bg-slate-700/50 transition-colors';
+
+  return (
+    <div className="h-full flex flex-col bg-white dark:bg-slate-900">
+      {/* Header with Search and Export */}
+      <div className="border-b border-slate-200 dark:border-slate-700 p-4 bg-slate-50 dark:bg-slate-800/50">
+        <div className="flex items-center justify-between mb-3">
+          <div>
+            <h3 className="text-lg font-semibold text-slate-900 dark:text-white">{title}</h3>
+            <p className="text-sm text-slate-600 dark:text-slate-400 mt-1">
+              {filteredAndSortedRows.length} of {rows.length} events
+            </p>
+          </div>
+          <button
+            onClick={handleExportCSV}
+            className="flex items-center gap-2 px-4 py-2 bg-blue-500/20 hover:bg-blue-500/30 text-blue-700 dark:text-blue-400 rounded font-medium transition-colors"
+          >
+            <Download size={16} />
+            Export CSV
+          </button>
+        </div>
+
+        <div className="relative max-w-md">
+          <Search size={16} className="absolute left-3 top-1/2 -translate-y-1/2 text-slate-400 dark:text-slate-400" />
+          <input
+            type="text"
+            value={searchTerm}
+            onChange={(e) => setSearchTerm(e.target.value)}
+            placeholder="Search..."
+            className="w-full bg-white dark:bg-slate-900 border border-slate-300 dark:border-slate-700 rounded pl-10 pr-4 py-2 text-sm text-slate-900 dark:text-slate-200 placeholder-slate-400 dark:placeholder-slate-500 focus:outline-none focus:border-blue-500"
+          />
+        </div>
+      </div>
+
+      {/* Events Table */}
+      <div className="flex-grow overflow-auto">
+        <table className="w-full text-sm">
+          <thead className="bg-slate-100 dark:bg-slate-800 sticky top-0 z-10">
+            <tr>
+              <th className={headerClass} onClick={() => handleSort('timestamp')}>
+                <div className="flex items-center gap-2">
+                  Timestamp
+                  <SortIcon field="timestamp" />
+                </div>
+              </th>
+              {columns.map(column => (
+                <th key={column.key} className={headerClass} onClick={() => handleSort(column.key)}>
+                  <div className="flex items-center gap-2">
+                    {column.label}
+                    <SortIcon field={column.key} />
+                  </div>
+                </th>
+              ))}
+            </tr>
+          </thead>
+          <tbody>
+            {filteredAndSortedRows.map((row, index) => (
+              <tr
+                key={index}
+                className="border-b border-slate-200 dark:border-slate-800 hover:bg-slate-100 dark:hover:bg-slate-800/50 transition-colors"
+              >
+                <td className="p-3 text-slate-600 dark:text-slate-400 font-mono text-xs">
+                  {new Date(String(row.timestamp)).toLocaleTimeString()}
+                </td>
+                {columns.map(column => (
+                  <td key={column.key} className="p-3">
+                    {column.badge ? (
+                      <span className={`text-xs px-2 py-1 rounded font-mono ${column.badge}`}>
+                        {row[column.key] === '' ? '-' : row[column.key]}
+                      </span>
+                    ) : (
+                      <span className="text-slate-700 dark:text-slate-300 font-mono text-xs">
+                        {row[column.key] === '' ? '-' : row[column.key]}
+                      </span>
+                    )}
+                  </td>
+                ))}
+              </tr>
+            ))}
+          </tbody>
+        </table>
+
+        {filteredAndSortedRows.length === 0 && searchTerm && (
+          <div className="text-center text-slate-500 dark:text-slate-500 py-12">
+            <Search size={48} className="mx-auto mb-4 opacity-50" />
+            <p>No events match your search</p>
+            <p className="text-sm mt-2">Try adjusting your search term</p>
+          </div>
+        )}
+      </div>
+    </div>
+  );
+};
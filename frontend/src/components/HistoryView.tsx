@@ -1,5 +1,5 @@
 import React, { useState } from 'react';
-import { Search, Calendar, Filter, Download, History as HistoryIcon, ChevronDown, ChevronUp } from 'lucide-react';
+import { Search, Calendar, Filter, Download, Upload, History as HistoryIcon, ChevronDown, ChevronUp } from 'lucide-react';
 import { api } from '../services/api';
 
 interface HistoryViewProps {
@@ -11,6 +11,7 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
   const [expandedEvents, setExpandedEvents] = useState<Set<number>>(new Set());
+  const [nextCursor, setNextCursor] = useState<string | undefined>();
 
   // Filter state
   const [filters, setFilters] = useState({
@@ -37,8 +38,9 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
     setLoading(true);
     setError(null);
     try {
-      const results = await api.queryEvents(filters);
-      setEvents(results);
+      const page = await api.queryEvents(filters);
+      setEvents(page.events);
+      setNextCursor(page.next_cursor);
     } catch (err: any) {
       setError(err.message || 'Failed to query events');
       console.error('Failed to query events:', err);
@@ -47,6 +49,37 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
     }
   };
 
+  const handleLoadMore = async () => {
+    if (!nextCursor) return;
+    setLoading(true);
+    setError(null);
+    try {
+      const page = await api.queryEvents({ ...filters, cursor: nextCursor });
+      setEvents(prev => [...prev, ...page.events]);
+      setNextCursor(page.next_cursor);
+    } catch (err: any) {
+      setError(err.message || 'Failed to query events');
+      console.error('Failed to query events:', err);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // Import an exported session or raw gadget output and open it for replay
+  const handleImport = async (e: React.ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0];
+    e.target.value = '';
+    if (!file) return;
+    setError(null);
+    try {
+      const session = await api.importSession(file, filters.event_type || undefined);
+      onReplaySession(session.session_id);
+    } catch (err: any) {
+      setError(err.response?.data || err.message || 'Failed to import session');
+      console.error('Failed to import session:', err);
+    }
+  };
+
   const handleReset = () => {
     setFilters({
       event_type: '',
@@ -57,6 +90,7 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
       limit: 100,
     });
     setEvents([]);
+    setNextCursor(undefined);
   };
 
   const toggleEventExpansion = (index: number) => {
@@ -124,8 +158,14 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
                 <option value="">All Types</option>
                 <option value="trace_sni">Trace SNI</option>
                 <option value="trace_tcp">Trace TCP</option>
+                <option value="trace_dns">Trace DNS</option>
+                <option value="trace_exec">Trace Exec</option>
+                <option value="trace_open">Trace Open</option>
                 <option value="snapshot_process">Snapshot Process</option>
                 <option value="snapshot_socket">Snapshot Socket</option>
+                <option value="top_tcp">Top TCP</option>
+                <option value="top_file">Top File</option>
+                <option value="top_block_io">Top Block I/O</option>
               </select>
             </div>
 
@@ -241,6 +281,14 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
             >
               Reset
             </button>
+            <label
+              title="Upload NDJSON exported from PENNY, or raw kubectl-gadget -o json output (set the event type filter to its gadget)"
+              className="flex items-center gap-2 px-4 py-2 bg-slate-300 dark:bg-slate-700 hover:bg-slate-400 dark:hover:bg-slate-600 text-slate-900 dark:text-white rounded font-medium transition-colors cursor-pointer"
+            >
+              <Upload size={16} />
+              Import
+              <input type="file" accept=".ndjson,.json,.jsonl" onChange={handleImport} className="hidden" />
+            </label>
             {events.length > 0 && (
               <button
                 onClick={exportToJSON}
@@ -328,6 +376,18 @@ export const HistoryView: React.FC<HistoryViewProps> = ({ onReplaySession }) =>
                 </div>
               ))}
             </div>
+
+            {nextCursor && (
+              <div className="p-4 border-t border-slate-200 dark:border-slate-700 text-center">
+                <button
+                  onClick={handleLoadMore}
+                  disabled={loading}
+                  className="px-4 py-2 bg-slate-300 dark:bg-slate-700 hover:bg-slate-400 dark:hover:bg-slate-600 disabled:opacity-50 text-slate-900 dark:text-white rounded font-medium transition-colors"
+                >
+                  {loading ? 'Loading...' : 'Load more'}
+                </button>
+              </div>
+            )}
           </div>
         )}
 
@@ -11,19 +11,23 @@ import {
   Clock,
   Timer
 } from 'lucide-react';
-import { GadgetSession, GadgetOutput } from '../types';
+import { GadgetSession, GadgetOutput, GadgetType, ParamSpec } from '../types';
+import { api } from '../services/api';
 import { TCPFlowDiagram } from './TCPFlowDiagram';
 import { TCPSummaryTable } from './TCPSummaryTable';
 import { ProcessSnapshotTable } from './ProcessSnapshotTable';
 import { SocketSnapshotTable } from './SocketSnapshotTable';
 import { TraceSNITable } from './TraceSNITable';
+import { EventTable } from './EventTable';
+import { TopFrameView } from './TopFrameView';
+import { eventColumns } from '../utils/eventColumns';
 
 interface Gadget {
   id: string;
   title: string;
   description: string;
   category: string;
-  type: 'trace_sni' | 'trace_tcp' | 'snapshot_process' | 'snapshot_socket';
+  type: GadgetType;
 }
 
 interface RunnerProps {
@@ -43,9 +47,15 @@ export const Runner: React.FC<RunnerProps> = ({
   onStop,
   outputs
 }) => {
+  // Gadgets with a table view besides the raw JSON. Top gadgets show one
+  // frame of rows at a time.
+  const eventTable = eventColumns[gadget.type];
+  const isTop = gadget.type.startsWith('top_');
+  const hasTable = gadget.type === 'snapshot_process' || gadget.type === 'snapshot_socket' ||
+                   gadget.type === 'trace_sni' || eventTable !== undefined;
+
   // Determine default tab based on gadget type
-  const defaultTab = gadget.type === 'trace_tcp' ? 'visual' :
-                     (gadget.type === 'snapshot_process' || gadget.type === 'snapshot_socket' || gadget.type === 'trace_sni') ? 'table' : 'raw';
+  const defaultTab = gadget.type === 'trace_tcp' ? 'visual' : hasTable ? 'table' : 'raw';
   const [activeTab, setActiveTab] = useState<'visual' | 'summary' | 'table' | 'raw'>(defaultTab as any);
   const [namespace, setNamespace] = useState('default');
   const [podName, setPodName] = useState('');
@@ -53,9 +63,28 @@ export const Runner: React.FC<RunnerProps> = ({
   const [elapsedTime, setElapsedTime] = useState<string>('0s');
   const [remainingTime, setRemainingTime] = useState<string>('');
   const [timeoutProgress, setTimeoutProgress] = useState<number>(0);
+  // Parameters advertised by GET /api/gadgets and the values entered for them
+  const [paramSpecs, setParamSpecs] = useState<ParamSpec[]>([]);
+  const [params, setParams] = useState<Record<string, any>>({});
 
   const isRunning = session?.status === 'running';
 
+  // Load the gadget's parameter schema. trace_tcp keeps its own filter radio.
+  useEffect(() => {
+    if (gadget.type === 'trace_tcp') return;
+    api.getGadgets()
+      .then(gadgets => {
+        const specs = gadgets.find(g => g.type === gadget.type)?.params || [];
+        setParamSpecs(specs);
+        const defaults: Record<string, any> = {};
+        specs.forEach(spec => {
+          if (spec.default !== undefined) defaults[spec.name] = spec.default;
+        });
+        setParams(defaults);
+      })
+      .catch(error => console.error('Failed to load gadget parameters:', error));
+  }, [gadget.type]);
+
   // Update elapsed time and remaining time every second
   useEffect(() => {
     if (!session?.startTime || !isRunning) {
@@ -118,6 +147,14 @@ export const Runner: React.FC<RunnerProps> = ({
       podName: podName || undefined,
     };
 
+    // Only send params that were set; the backend validates them
+    const setParamValues = Object.fromEntries(
+      Object.entries(params).filter(([, value]) => value !== '' && value !== false && value !== undefined)
+    );
+    if (Object.keys(setParamValues).length > 0) {
+      config.params = setParamValues;
+    }
+
     // Add TCP-specific filter if it's a trace_tcp gadget and not "all"
     if (gadget.type === 'trace_tcp' && tcpFilter !== 'all') {
       if (tcpFilter === 'accept') config.acceptOnly = true;
@@ -282,6 +319,57 @@ export const Runner: React.FC<RunnerProps> = ({
               </div>
             </div>
           )}
+
+          {/* Gadget parameters */}
+          {paramSpecs.length > 0 && (
+            <div className="mt-4 grid grid-cols-2 gap-4">
+              {paramSpecs.map(spec => (
+                <div key={spec.name}>
+                  {spec.type === 'bool' ? (
+                    <label className="flex items-center gap-2 text-sm text-slate-700 dark:text-slate-300 cursor-pointer mt-5" title={spec.description}>
+                      <input
+                        type="checkbox"
+                        checked={!!params[spec.name]}
+                        onChange={(e) => setParams({ ...params, [spec.name]: e.target.checked })}
+                        className="rounded bg-white dark:bg-slate-900 border-slate-300 dark:border-slate-700"
+                      />
+                      {spec.description || spec.name}
+                    </label>
+                  ) : (
+                    <>
+                      <label className="block text-xs text-slate-600 dark:text-slate-400 mb-1">
+                        {spec.description || spec.name}
+                      </label>
+                      {spec.allowed ? (
+                        <select
+                          value={params[spec.name] ?? ''}
+                          onChange={(e) => setParams({ ...params, [spec.name]: e.target.value })}
+                          className="w-full bg-white dark:bg-slate-900 border border-slate-300 dark:border-slate-700 rounded px-3 py-2 text-sm text-slate-900 dark:text-slate-200 focus:outline-none focus:border-blue-500"
+                        >
+                          <option value="">Any</option>
+                          {spec.allowed.map(value => (
+                            <option key={value} value={value}>{value}</option>
+                          ))}
+                        </select>
+                      ) : (
+                        <input
+                          type={spec.type === 'int' ? 'number' : 'text'}
+                          min={spec.min}
+                          max={spec.max}
+                          value={params[spec.name] ?? ''}
+                          onChange={(e) => setParams({
+                            ...params,
+                            [spec.name]: spec.type === 'int' && e.target.value !== '' ? Number(e.target.value) : e.target.value
+                          })}
+                          className="w-full bg-white dark:bg-slate-900 border border-slate-300 dark:border-slate-700 rounded px-3 py-2 text-sm text-slate-900 dark:text-slate-200 focus:outline-none focus:border-blue-500"
+                        />
+                      )}
+                    </>
+                  )}
+                </div>
+              ))}
+            </div>
+          )}
         </div>
       )}
 
@@ -308,6 +396,14 @@ export const Runner: React.FC<RunnerProps> = ({
               </span>
             </div>
           )}
+          {session.params && Object.keys(session.params).length > 0 && (
+            <div className="flex items-center gap-2 bg-white dark:bg-slate-800 px-3 py-1 rounded border border-slate-300 dark:border-slate-700">
+              <Filter size={14} /> Params:
+              <span className="text-slate-900 dark:text-slate-200 font-mono">
+                {Object.entries(session.params).map(([name, value]) => `${name}=${value}`).join(', ')}
+              </span>
+            </div>
+          )}
         </div>
       )}
 
@@ -358,8 +454,8 @@ export const Runner: React.FC<RunnerProps> = ({
           </div>
         )}
 
-        {/* Show tabs for snapshot_process, snapshot_socket, and trace_sni */}
-        {(gadget.type === 'snapshot_process' || gadget.type === 'snapshot_socket' || gadget.type === 'trace_sni') && (
+        {/* Show tabs for gadgets with a table view */}
+        {hasTable && (
           <div className="flex border-b border-slate-200 dark:border-slate-700 bg-white dark:bg-slate-900">
             <button
               onClick={() => setActiveTab('table')}
@@ -369,7 +465,7 @@ export const Runner: React.FC<RunnerProps> = ({
                   : 'text-slate-600 dark:text-slate-400 hover:text-slate-900 dark:hover:text-slate-200'
               }`}
             >
-              Table View
+              {isTop ? 'Frames' : 'Table View'}
             </button>
             <button
               onClick={() => setActiveTab('raw')}
@@ -421,6 +517,20 @@ export const Runner: React.FC<RunnerProps> = ({
             <div className="h-full w-full">
               <TraceSNITable outputs={outputs} />
             </div>
+          ) : isTop && activeTab === 'table' ? (
+            <div className="h-full w-full">
+              <TopFrameView gadgetType={gadget.type} outputs={outputs} />
+            </div>
+          ) : eventTable && activeTab === 'table' ? (
+            <div className="h-full w-full">
+              <EventTable
+                title={eventTable.title}
+                outputs={outputs}
+                columns={eventTable.columns}
+                emptyHint={`Start the gadget to collect ${gadget.title} events`}
+                exportName={gadget.id}
+              />
+            </div>
           ) : (
             <div className="h-full overflow-auto p-6">
               {!isRunning && outputs.length === 0 ? (
@@ -1,6 +1,8 @@
 import React, { useState, useEffect } from 'react';
 import { X, Play, Pause, RotateCcw, BarChart2, Download } from 'lucide-react';
 import { api } from '../services/api';
+import { ExportFormat } from '../types';
+import { TopFrameView } from './TopFrameView';
 
 interface SessionReplayProps {
   sessionId: string;
@@ -17,6 +19,7 @@ export const SessionReplay: React.FC<SessionReplayProps> = ({ sessionId, onClose
   const [isPlaying, setIsPlaying] = useState(false);
   const [currentIndex, setCurrentIndex] = useState(0);
   const [playbackSpeed, setPlaybackSpeed] = useState(1);
+  const [exportFormat, setExportFormat] = useState<ExportFormat>('ndjson');
 
   useEffect(() => {
     loadSessionData();
@@ -47,7 +50,7 @@ export const SessionReplay: React.FC<SessionReplayProps> = ({ sessionId, onClose
     setError(null);
     try {
       const [eventsData, statsData] = await Promise.all([
-        api.getSessionEvents(sessionId),
+        api.getAllSessionEvents(sessionId),
         api.getSessionStats(sessionId).catch(() => null),
       ]);
       setEvents(eventsData);
@@ -74,15 +77,12 @@ export const SessionReplay: React.FC<SessionReplayProps> = ({ sessionId, onClose
     setIsPlaying(false);
   };
 
-  const exportToJSON = () => {
-    const dataStr = JSON.stringify(events, null, 2);
-    const dataBlob = new Blob([dataStr], { type: 'application/json' });
-    const url = URL.createObjectURL(dataBlob);
+  // Exports stream every stored event from the backend, not just the loaded ones
+  const exportSession = () => {
     const link = document.createElement('a');
-    link.href = url;
-    link.download = `session-${sessionId}-events.json`;
+    link.href = api.getExportUrl(sessionId, exportFormat);
+    link.download = `session-${sessionId}.${exportFormat}`;
     link.click();
-    URL.revokeObjectURL(url);
   };
 
   const formatTimestamp = (timestamp: string) => {
@@ -105,6 +105,8 @@ export const SessionReplay: React.FC<SessionReplayProps> = ({ sessionId, onClose
   };
 
   const currentEvent = events[currentIndex];
+  // Top gadget sessions are replayed frame by frame rather than row by row
+  const framed = events.some(event => event.frame);
   const progress = events.length > 0 ? ((currentIndex + 1) / events.length) * 100 : 0;
 
   return (
@@ -219,8 +221,21 @@ export const SessionReplay: React.FC<SessionReplayProps> = ({ sessionId, onClose
                   <option value={10}>10x</option>
                 </select>
 
+                <select
+                  value={exportFormat}
+                  onChange={(e) => setExportFormat(e.target.value as ExportFormat)}
+                  className="px-3 py-2 bg-slate-200 dark:bg-slate-700 text-slate-900 dark:text-white rounded text-sm border border-slate-300 dark:border-slate-600"
+                >
+                  <option value="ndjson">NDJSON</option>
+                  <option value="csv">CSV</option>
+                  <option value="json">JSON</option>
+                  {events[0]?.eventType === 'trace_tcp' && (
+                    <option value="pcapng">pcapng</option>
+                  )}
+                </select>
+
                 <button
-                  onClick={exportToJSON}
+                  onClick={exportSession}
                   className="flex items-center gap-2 px-4 py-2 bg-green-600 hover:bg-green-700 text-white rounded text-sm"
                 >
                   <Download size={16} />
@@ -229,8 +244,15 @@ export const SessionReplay: React.FC<SessionReplayProps> = ({ sessionId, onClose
               </div>
             </div>
 
+            {/* Frames replayed so far */}
+            {currentEvent && framed && (
+              <div className="flex-grow overflow-hidden min-h-[24rem]">
+                <TopFrameView gadgetType={currentEvent.eventType} outputs={events.slice(0, currentIndex + 1)} />
+              </div>
+            )}
+
             {/* Current event display */}
-            {currentEvent && (
+            {currentEvent && !framed && (
               <div className="flex-grow p-6 overflow-y-auto">
                 <div className="bg-slate-50 dark:bg-slate-900 rounded-lg p-4 mb-4 border border-slate-200 dark:border-slate-700">
                   <div className="flex items-center justify-between mb-3">
@@ -0,0 +1,96 @@
+import React, { useMemo, useState } from 'react';
+import { ChevronLeft, ChevronRight, ChevronsLeft, ChevronsRight, BarChart2 } from 'lucide-react';
+import { GadgetOutput, GadgetType } from '../types';
+import { EventTable } from './EventTable';
+import { eventColumns } from '../utils/eventColumns';
+
+interface Props {
+  gadgetType: GadgetType;
+  outputs: GadgetOutput[];
+}
+
+// TopFrameView steps through the frames of an interval (top) gadget. Every
+// frame is a complete table, so only one is shown at a time; by default the
+// view follows the latest frame as new ones arrive.
+export const TopFrameView: React.FC<Props> = ({ gadgetType, outputs }) => {
+  const [selectedFrame, setSelectedFrame] = useState<number | null>(null);
+
+  const frames = useMemo(() => {
+    const byFrame = new Map<number, GadgetOutput[]>();
+    outputs.forEach(output => {
+      if (!output.frame) return;
+      const rows = byFrame.get(output.frame) || [];
+      rows.push(output);
+      byFrame.set(output.frame, rows);
+    });
+    return byFrame;
+  }, [outputs]);
+
+  const frameNumbers = useMemo(() => Array.from(frames.keys()).sort((a, b) => a - b), [frames]);
+  const following = selectedFrame === null || !frames.has(selectedFrame);
+  const current: number = following ? frameNumbers[frameNumbers.length - 1] : selectedFrame as number;
+  const position = frameNumbers.indexOf(current);
+  const rows = frames.get(current) || [];
+  const frameTime = rows[0]?.frameTime || rows[0]?.timestamp;
+  const table = eventColumns[gadgetType];
+
+  const goTo = (index: number) => {
+    const clamped = Math.max(0, Math.min(frameNumbers.length - 1, index));
+    // Selecting the last frame resumes following new frames
+    setSelectedFrame(clamped === frameNumbers.length - 1 ? null : frameNumbers[clamped]);
+  };
+
+  if (frameNumbers.length === 0 || !table) {
+    return (
+      <div className="h-full flex flex-col items-center justify-center text-slate-500 dark:text-slate-500">
+        <BarChart2 size={48} className="mb-4 opacity-50" />
+        <p>No frames received yet...</p>
+        <p className="text-sm mt-2">Frames arrive once per interval while the gadget runs</p>
+      </div>
+    );
+  }
+
+  const buttonClass = 'p-1.5 rounded bg-slate-200 dark:bg-slate-800 hover:bg-slate-300 dark:hover:bg-slate-700 text-slate-700 dark:text-slate-300 disabled:opacity-40 disabled:cursor-not-allowed';
+
+  return (
+    <div className="h-full flex flex-col">
+      {/* Frame stepper */}
+      <div className="flex items-center gap-2 px-4 py-2 border-b border-slate-200 dark:border-slate-700 bg-white dark:bg-slate-900 text-sm">
+        <button onClick={() => goTo(0)} disabled={position <= 0} className={buttonClass} title="First frame">
+          <ChevronsLeft size={16} />
+        </button>
+        <button onClick={() => goTo(position - 1)} disabled={position <= 0} className={buttonClass} title="Previous frame">
+          <ChevronLeft size={16} />
+        </button>
+        <span className="font-mono text-slate-700 dark:text-slate-300">
+          Frame {current} ({position + 1} of {frameNumbers.length})
+        </span>
+        <button onClick={() => goTo(position + 1)} disabled={following} className={buttonClass} title="Next frame">
+          <ChevronRight size={16} />
+        </button>
+        <button onClick={() => goTo(frameNumbers.length - 1)} disabled={following} className={buttonClass} title="Latest frame">
+          <ChevronsRight size={16} />
+        </button>
+        {frameTime && (
+          <span className="text-slate-500 dark:text-slate-400 text-xs ml-2">
+            {new Date(frameTime).toLocaleTimeString()}
+          </span>
+        )}
+        <span className={`ml-auto text-xs ${following ? 'text-green-600 dark:text-green-400' : 'text-slate-500 dark:text-slate-400'}`}>
+          {following ? 'Following latest frame' : 'Paused on frame'}
+        </span>
+      </div>
+
+      <div className="flex-grow overflow-hidden">
+        <EventTable
+          title={table.title}
+          outputs={rows}
+          columns={table.columns}
+          defaultSort={table.defaultSort}
+          emptyHint="This frame has no rows"
+          exportName={`${gadgetType}-frame-${current}`}
+        />
+      </div>
+    </div>
+  );
+};
@@ -1,8 +1,12 @@
 import axios from 'axios';
-import { Gadget, GadgetRequest, GadgetSession } from '../types';
+import { EventPage, ExportFormat, Gadget, GadgetRequest, GadgetSession } from '../types';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || '/api';
 
+// Event queries without a limit or cursor are answered with a bare array
+const toEventPage = (data: EventPage | any[] | null): EventPage =>
+  Array.isArray(data) ? { events: data } : data || { events: [] };
+
 export const api = {
   async getGadgets(): Promise<Gadget[]> {
     const response = await axios.get(`${API_BASE_URL}/gadgets`);
@@ -23,10 +27,12 @@ export const api = {
     await axios.delete(`${API_BASE_URL}/sessions/${sessionId}`);
   },
 
-  getWebSocketUrl(sessionId: string): string {
+  getWebSocketUrl(sessionId: string, since?: number): string {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const host = import.meta.env.VITE_WS_URL || window.location.host;
-    return `${protocol}//${host}/ws/${sessionId}`;
+    // Resume after the last received event so nothing is lost on reconnect
+    const query = since !== undefined ? `?since=${since}` : '';
+    return `${protocol}//${host}/ws/${sessionId}${query}`;
   },
 
   // Historical data queries
@@ -37,7 +43,9 @@ export const api = {
     start_time?: string;
     end_time?: string;
     limit?: number;
-  }): Promise<any[]> {
+    order?: 'asc' | 'desc';
+    cursor?: string;
+  }): Promise<EventPage> {
     const params = new URLSearchParams();
     Object.entries(filters).forEach(([key, value]) => {
       if (value !== undefined && value !== '') {
@@ -45,13 +53,49 @@ export const api = {
       }
     });
     const response = await axios.get(`${API_BASE_URL}/events?${params.toString()}`);
-    return response.data || [];
+    return toEventPage(response.data);
+  },
+
+  async getSessionEvents(sessionId: string, page: {
+    limit?: number;
+    order?: 'asc' | 'desc';
+    cursor?: string;
+  } = {}): Promise<EventPage> {
+    const params = new URLSearchParams();
+    Object.entries(page).forEach(([key, value]) => {
+      if (value !== undefined) {
+        params.append(key, String(value));
+      }
+    });
+    const query = params.toString() ? `?${params.toString()}` : '';
+    const response = await axios.get(`${API_BASE_URL}/sessions/${sessionId}/events${query}`);
+    return toEventPage(response.data);
+  },
+
+  // getAllSessionEvents walks every page of a session's events, oldest first
+  async getAllSessionEvents(sessionId: string): Promise<any[]> {
+    const events: any[] = [];
+    let cursor: string | undefined;
+    do {
+      const page = await api.getSessionEvents(sessionId, { order: 'asc', limit: 10000, cursor });
+      events.push(...page.events);
+      cursor = page.next_cursor;
+    } while (cursor);
+    return events;
   },
 
-  async getSessionEvents(sessionId: string, limit?: number): Promise<any[]> {
-    const params = limit ? `?limit=${limit}` : '';
-    const response = await axios.get(`${API_BASE_URL}/sessions/${sessionId}/events${params}`);
-    return response.data || [];
+  getExportUrl(sessionId: string, format: ExportFormat): string {
+    return `${API_BASE_URL}/sessions/${sessionId}/export?format=${format}`;
+  },
+
+  // importSession uploads NDJSON or raw gadget JSON as a new session.
+  // gadgetType is required for raw kubectl-gadget output.
+  async importSession(file: File, gadgetType?: string): Promise<any> {
+    const params = gadgetType ? `?type=${encodeURIComponent(gadgetType)}` : '';
+    const response = await axios.post(`${API_BASE_URL}/sessions/import${params}`, file, {
+      headers: { 'Content-Type': 'application/x-ndjson' },
+    });
+    return response.data;
   },
 
   async getSessionStats(sessionId: string): Promise<any> {
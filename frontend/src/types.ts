@@ -1,10 +1,33 @@
-export type GadgetType = 'trace_sni' | 'trace_tcp' | 'snapshot_process' | 'snapshot_socket';
+export type GadgetType =
+  | 'trace_sni'
+  | 'trace_tcp'
+  | 'trace_dns'
+  | 'trace_exec'
+  | 'trace_open'
+  | 'snapshot_process'
+  | 'snapshot_socket'
+  | 'top_tcp'
+  | 'top_file'
+  | 'top_block_io';
+
+// Parameter a gadget accepts, as advertised by GET /api/gadgets
+export interface ParamSpec {
+  name: string;
+  type: 'bool' | 'string' | 'int';
+  description?: string;
+  default?: any;
+  allowed?: string[]; // allowed values for string params
+  min?: number; // bounds for int params
+  max?: number;
+}
 
 export interface Gadget {
   type: GadgetType;
   name: string;
   description: string;
   category: string;
+  outputMode?: 'streaming' | 'snapshot' | 'interval';
+  params?: ParamSpec[];
 }
 
 export interface GadgetRequest {
@@ -13,6 +36,11 @@ export interface GadgetRequest {
   podName?: string;
   container?: string;
   params?: Record<string, any>;
+  timeoutSeconds?: number;
+  pinned?: boolean;
+  overflowPolicy?: 'drop' | 'block' | 'drop-oldest' | 'sample';
+  sampleRate?: number; // keep 1 in sampleRate events with the sample policy
+  filter?: string; // e.g. `dst.port == 5432 && error != 0`
   // TCP trace specific flags
   acceptOnly?: boolean;
   connectOnly?: boolean;
@@ -27,14 +55,40 @@ export interface GadgetSession {
   startTime?: string;
   status: string;
   timeout?: number; // in nanoseconds
+  deadline?: string; // unset for pinned sessions
+  owner?: string; // backend instance running the gadget
+  reason?: string; // why a failed session failed
+  counters?: SessionCounters;
+  pinned?: boolean;
+  params?: Record<string, any>;
   acceptOnly?: boolean;
   connectOnly?: boolean;
   failureOnly?: boolean;
 }
 
+export interface SessionCounters {
+  received: number;
+  filtered: number; // excluded by the session's filter
+  dropped: number; // dropped at the gadget output buffer
+  sampled: number; // skipped by sampling at the gadget output buffer
+  clientDropped: number; // dropped at WebSocket send buffers, summed over clients
+  persistFailed: number;
+}
+
 export interface GadgetOutput {
   sessionId: string;
   timestamp: string;
   data: Record<string, any>;
   eventType: string;
+  seq?: number; // increases monotonically within a session
+  frame?: number; // interval (top) gadgets: the frame the row belongs to
+  frameTime?: string;
+}
+
+// Formats served by GET /api/sessions/{id}/export; pcapng is trace_tcp only
+export type ExportFormat = 'ndjson' | 'csv' | 'json' | 'pcapng';
+
+export interface EventPage {
+  events: GadgetOutput[];
+  next_cursor?: string; // pass as cursor to fetch the following page
 }
@@ -0,0 +1,89 @@
+import { EventColumn, k8sColumns } from '../components/EventTable';
+import { GadgetType } from '../types';
+
+// Table columns for the gadgets shown with EventTable, following the JSON
+// fields of the models in backend/internal/models
+export const eventColumns: Partial<Record<GadgetType, {
+  title: string;
+  columns: EventColumn[];
+  defaultSort?: string;
+}>> = {
+  trace_dns: {
+    title: 'DNS Trace Events',
+    columns: [
+      ...k8sColumns,
+      { key: 'qr', label: 'Q/R', value: d => String(d.qr || '') },
+      { key: 'qtype', label: 'Type', value: d => String(d.qtype || ''),
+        badge: 'bg-yellow-500/20 text-yellow-700 dark:text-yellow-400' },
+      { key: 'name', label: 'Name', value: d => String(d.name || ''),
+        badge: 'bg-purple-500/20 text-purple-700 dark:text-purple-400 font-semibold' },
+      { key: 'rcode', label: 'Response', value: d => String(d.rcode || '') },
+      { key: 'addresses', label: 'Addresses', value: d => (d.addresses || []).join(', ') },
+      { key: 'latency', label: 'Latency (ms)', value: d => Number(d.latency || 0) / 1e6 },
+      { key: 'nameserver', label: 'Nameserver', value: d => String(d.nameserver || '') },
+    ],
+  },
+  trace_exec: {
+    title: 'Exec Trace Events',
+    columns: [
+      ...k8sColumns,
+      { key: 'ppid', label: 'PPID', value: d => Number(d.ppid || 0) },
+      { key: 'uid', label: 'UID', value: d => Number(d.uid || 0) },
+      { key: 'args', label: 'Arguments', value: d => (d.args || []).join(' '),
+        badge: 'bg-purple-500/20 text-purple-700 dark:text-purple-400' },
+      { key: 'cwd', label: 'Working Dir', value: d => String(d.cwd || '') },
+      { key: 'error', label: 'Error', value: d => Number(d.error || 0) },
+    ],
+  },
+  trace_open: {
+    title: 'Open Trace Events',
+    columns: [
+      ...k8sColumns,
+      { key: 'fname', label: 'Path', value: d => String(d.fname || ''),
+        badge: 'bg-purple-500/20 text-purple-700 dark:text-purple-400' },
+      { key: 'flags', label: 'Flags', value: d => Number(d.flags || 0) },
+      { key: 'mode', label: 'Mode', value: d => Number(d.mode || 0).toString(8) },
+      { key: 'fd', label: 'FD', value: d => Number(d.fd || 0) },
+      { key: 'error', label: 'Error', value: d => Number(d.error || 0) },
+    ],
+  },
+  top_tcp: {
+    title: 'TCP Activity',
+    defaultSort: 'sent',
+    columns: [
+      ...k8sColumns,
+      { key: 'src', label: 'Source', value: d => `${d.srcIp || d.src?.addr || ''}:${d.srcPort || d.src?.port || ''}` },
+      { key: 'dst', label: 'Destination', value: d => `${d.dstIp || d.dst?.addr || ''}:${d.dstPort || d.dst?.port || ''}`,
+        badge: 'bg-purple-500/20 text-purple-700 dark:text-purple-400' },
+      { key: 'sent', label: 'Sent (B)', value: d => Number(d.sent || 0) },
+      { key: 'received', label: 'Received (B)', value: d => Number(d.received || 0) },
+    ],
+  },
+  top_file: {
+    title: 'File Activity',
+    defaultSort: 'readBytes',
+    columns: [
+      ...k8sColumns,
+      { key: 'filename', label: 'File', value: d => String(d.filename || ''),
+        badge: 'bg-purple-500/20 text-purple-700 dark:text-purple-400' },
+      { key: 'fileType', label: 'Type', value: d => String(d.fileType || '') },
+      { key: 'reads', label: 'Reads', value: d => Number(d.reads || 0) },
+      { key: 'writes', label: 'Writes', value: d => Number(d.writes || 0) },
+      { key: 'readBytes', label: 'Read (B)', value: d => Number(d.readBytes || 0) },
+      { key: 'writeBytes', label: 'Written (B)', value: d => Number(d.writeBytes || 0) },
+    ],
+  },
+  top_block_io: {
+    title: 'Block I/O Activity',
+    defaultSort: 'bytes',
+    columns: [
+      ...k8sColumns,
+      { key: 'device', label: 'Device', value: d => `${d.major ?? ''}:${d.minor ?? ''}` },
+      { key: 'write', label: 'R/W', value: d => (d.write ? 'W' : 'R'),
+        badge: 'bg-yellow-500/20 text-yellow-700 dark:text-yellow-400' },
+      { key: 'bytes', label: 'Bytes', value: d => Number(d.bytes || 0) },
+      { key: 'us', label: 'Time (µs)', value: d => Number(d.us || 0) },
+      { key: 'ops', label: 'I/Os', value: d => Number(d.ops || 0) },
+    ],
+  },
+};